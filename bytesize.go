@@ -0,0 +1,234 @@
+package emp
+
+import (
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes, written in a human-friendly form such as
+// "512KB", "200MiB" or "1.5G". Decimal units (KB, MB, ...) are powers of
+// 1000, binary units (KiB, MiB, ...) are powers of 1024, and a number
+// without unit is a number of bytes. Units are case-insensitive.
+//
+// Plain integer fields can be parsed the same way by tagging them with
+// "bytesize".
+type ByteSize uint64
+
+// byteUnits are the units of ByteSize, from the largest to the smallest.
+var byteUnits = []struct {
+	name string
+	size uint64
+}{
+	{"PiB", 1 << 50},
+	{"PB", 1e15},
+	{"TiB", 1 << 40},
+	{"TB", 1e12},
+	{"GiB", 1 << 30},
+	{"GB", 1e9},
+	{"MiB", 1 << 20},
+	{"MB", 1e6},
+	{"KiB", 1 << 10},
+	{"KB", 1e3},
+}
+
+// parseByteSize parses a size such as "512KB", "200MiB" or "1.5G".
+func parseByteSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	number, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+
+	size := uint64(0)
+	switch unit {
+	case "", "b":
+		size = 1
+	default:
+		for _, byteUnit := range byteUnits {
+			name := strings.ToLower(byteUnit.name)
+			// "K" and "KB" are the same unit
+			if unit == name || unit+"b" == name {
+				size = byteUnit.size
+				break
+			}
+		}
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("unknown unit %q of byte size %q", s[i:], s)
+	}
+
+	res := math.Round(f * float64(size))
+	if res >= math.MaxUint64 {
+		return 0, fmt.Errorf("byte size %q overflows", s)
+	}
+	return uint64(res), nil
+}
+
+// formatByteSize formats size with the largest unit it is a whole number
+// of.
+func formatByteSize(size uint64) string {
+	for _, byteUnit := range byteUnits {
+		if size != 0 && size%byteUnit.size == 0 {
+			return strconv.FormatUint(size/byteUnit.size, 10) + byteUnit.name
+		}
+	}
+	return strconv.FormatUint(size, 10) + "B"
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := parseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// String returns the size with the largest unit it is a whole number of,
+// e.g. "200MiB".
+func (b ByteSize) String() string {
+	return formatByteSize(uint64(b))
+}
+
+// Percent is a ratio, written either as a percentage such as "75%" or as a
+// fraction such as "0.75". Both are parsed to 0.75.
+//
+// Plain float fields can be parsed the same way by tagging them with
+// "percent".
+type Percent float64
+
+// parsePercent parses a ratio such as "75%" or "0.75".
+func parsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid percent %q", s)
+		}
+		return f / 100, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percent %q", s)
+	}
+	return f, nil
+}
+
+// formatPercent formats ratio as the shortest percentage that parses back
+// to it.
+func formatPercent(ratio float64) string {
+	for prec := 0; prec < 17; prec++ {
+		s := strconv.FormatFloat(ratio*100, 'f', prec, 64)
+		if f, _ := strconv.ParseFloat(s, 64); f/100 == ratio {
+			return s + "%"
+		}
+	}
+	return strconv.FormatFloat(ratio*100, 'f', -1, 64) + "%"
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Percent) UnmarshalText(text []byte) error {
+	ratio, err := parsePercent(string(text))
+	if err != nil {
+		return err
+	}
+	*p = Percent(ratio)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Percent) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// String returns the ratio as a percentage, e.g. "75%".
+func (p Percent) String() string {
+	return formatPercent(float64(p))
+}
+
+// parseByteSize parses an integer field tagged with "bytesize".
+func (p *Parser) parseByteSize(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+	isInt := val.Kind() >= reflect.Int && val.Kind() <= reflect.Int64
+
+	if p.marshal {
+		if isInt {
+			if val.Int() < 0 {
+				p.marshalEnv(prefix+name, strconv.FormatInt(val.Int(), 10))
+				return nil
+			}
+			p.marshalEnv(prefix+name, formatByteSize(uint64(val.Int())))
+			return nil
+		}
+		p.marshalEnv(prefix+name, formatByteSize(val.Uint()))
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseByteSize(envString)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	if isInt {
+		if value > math.MaxInt64 || val.OverflowInt(int64(value)) {
+			return empErr.CannotParseEnvStringToTypeError.New().Wrap(fmt.Sprintf("byte size %q overflows %s", envString, val.Type()))
+		}
+		val.SetInt(int64(value))
+		return nil
+	}
+
+	if val.OverflowUint(value) {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(fmt.Sprintf("byte size %q overflows %s", envString, val.Type()))
+	}
+	val.SetUint(value)
+	return nil
+}
+
+// parsePercent parses a float field tagged with "percent".
+func (p *Parser) parsePercent(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+
+	if p.marshal {
+		p.marshalEnv(prefix+name, formatPercent(val.Float()))
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := parsePercent(envString)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.SetFloat(value)
+	return nil
+}
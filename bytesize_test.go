@@ -0,0 +1,130 @@
+package emp
+
+import (
+	"errors"
+	"github.com/XMLHexagram/emp/empErr"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestByteSize(t *testing.T) {
+	for s, expect := range map[string]uint64{
+		"200":     200,
+		"200B":    200,
+		"512KB":   512000,
+		"512k":    512000,
+		"200MiB":  200 << 20,
+		"1.5G":    1500000000,
+		"1.5 GiB": 1536 << 20,
+		"2TB":     2e12,
+	} {
+		res, err := parseByteSize(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expect, res, s)
+	}
+
+	for _, s := range []string{"", "MB", "12XB", "-1KB", "1e30PB"} {
+		_, err := parseByteSize(s)
+		assert.Error(t, err, s)
+	}
+
+	for size, expect := range map[uint64]string{
+		0:          "0B",
+		200:        "200B",
+		512000:     "500KiB",
+		200 << 20:  "200MiB",
+		1500000000: "1500MB",
+	} {
+		assert.Equal(t, expect, formatByteSize(size))
+	}
+}
+
+func TestPercent(t *testing.T) {
+	for s, expect := range map[string]float64{
+		"75%":  0.75,
+		"7%":   0.07,
+		"0.75": 0.75,
+		"150%": 1.5,
+		"0":    0,
+	} {
+		res, err := parsePercent(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expect, res, s)
+	}
+
+	for ratio, expect := range map[float64]string{
+		0.75:  "75%",
+		0.07:  "7%",
+		0.125: "12.5%",
+		1.5:   "150%",
+	} {
+		assert.Equal(t, expect, formatPercent(ratio))
+	}
+}
+
+func TestByteSizeAndPercentFields(t *testing.T) {
+	type args struct {
+		MaxSize   ByteSize   `emp:"MAX_SIZE"`
+		Buffers   []ByteSize `emp:"BUFFERS"`
+		MaxBody   int64      `emp:"MAX_BODY,bytesize"`
+		CacheSize uint32     `emp:"CACHE_SIZE,bytesize"`
+		Sampling  Percent    `emp:"SAMPLING"`
+		Threshold float64    `emp:"THRESHOLD,percent"`
+	}
+
+	source := MapSource{
+		"MAX_SIZE":   "200MiB",
+		"BUFFERS":    "4KiB,64KiB",
+		"MAX_BODY":   "1.5MB",
+		"CACHE_SIZE": "512KB",
+		"SAMPLING":   "0.25",
+		"THRESHOLD":  "75%",
+	}
+
+	expect := &args{
+		MaxSize:   200 << 20,
+		Buffers:   []ByteSize{4 << 10, 64 << 10},
+		MaxBody:   1500000,
+		CacheSize: 512000,
+		Sampling:  0.25,
+		Threshold: 0.75,
+	}
+
+	res := new(args)
+
+	parser, err := NewParser(&Config{
+		Source: source,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expect, res)
+
+	out, err := parser.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `MAX_SIZE=200MiB
+BUFFERS=4KiB,64KiB
+MAX_BODY=1500KB
+CACHE_SIZE=500KiB
+SAMPLING=25%
+THRESHOLD=75%
+`, out)
+
+	source["CACHE_SIZE"] = "5GB"
+
+	err = parser.Parse(new(args))
+
+	assert.True(t, errors.Is(err, empErr.CannotParseEnvStringToTypeError.New()))
+}
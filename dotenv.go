@@ -0,0 +1,305 @@
+package emp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ReadDotenv reads the given env files and returns their values as a
+// MapSource. When a key appears in more than one file, the later file wins.
+//
+// The format is the one emitted by Marshal, plus what is commonly found
+// in the wild:
+//
+//     # comments and blank lines are skipped
+//     export KEY=value          # the export prefix is optional
+//     UNQUOTED=value           # trailing comments are stripped
+//     SINGLE='literal $value'  # no escape sequences in single quotes
+//     DOUBLE="line1\nline2"    # \n, \r, \t, \", \\ are unescaped
+//     MULTILINE="line1
+//     line2"
+func ReadDotenv(filenames ...string) (MapSource, error) {
+	res := MapSource{}
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := parseDotenv(filename, content)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range values {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// ParseDotenv reads env file formatted content from r and returns its values
+// as a MapSource. See ReadDotenv for the supported syntax.
+func ParseDotenv(r io.Reader) (MapSource, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseDotenv("", content)
+}
+
+// dotenvParser scans the content of an env file, keeping track of the
+// current line for error messages.
+type dotenvParser struct {
+	name string
+	src  []byte
+	pos  int
+	line int
+}
+
+func parseDotenv(name string, content []byte) (MapSource, error) {
+	p := &dotenvParser{
+		name: name,
+		src:  bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")),
+		line: 1,
+	}
+
+	res := MapSource{}
+	for {
+		p.skipBlankAndComment()
+		if p.eof() {
+			return res, nil
+		}
+
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		res[key] = value
+	}
+}
+
+func (p *dotenvParser) errorf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.name == "" {
+		return empErr.DotenvSyntaxError.New().Wrap(fmt.Sprintf("line %d: %s", p.line, msg))
+	}
+	return empErr.DotenvSyntaxError.New().Wrap(fmt.Sprintf("%s:%d: %s", p.name, p.line, msg))
+}
+
+func (p *dotenvParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *dotenvParser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *dotenvParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *dotenvParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *dotenvParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *dotenvParser) skipBlankAndComment() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.next()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine consumes the rest of the line after a value, which may only
+// contain spaces and a comment.
+func (p *dotenvParser) endOfLine() error {
+	p.skipSpaces()
+	if p.eof() {
+		return nil
+	}
+	switch p.peek() {
+	case '\r', '\n':
+		p.skipLine()
+		return nil
+	case '#':
+		p.skipLine()
+		return nil
+	}
+	return p.errorf("unexpected character %q after quoted value", p.peek())
+}
+
+func isDotenvKeyChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *dotenvParser) parseKey() (string, error) {
+	if bytes.HasPrefix(p.src[p.pos:], []byte("export ")) || bytes.HasPrefix(p.src[p.pos:], []byte("export\t")) {
+		p.pos += len("export")
+		p.skipSpaces()
+	}
+
+	start := p.pos
+	for !p.eof() && isDotenvKeyChar(p.peek()) {
+		p.next()
+	}
+	key := string(p.src[start:p.pos])
+	if key == "" {
+		if p.eof() {
+			return "", p.errorf("expected key, got end of input")
+		}
+		return "", p.errorf("expected key, got %q", p.peek())
+	}
+
+	p.skipSpaces()
+	if p.eof() || p.peek() != '=' {
+		return "", p.errorf("expected '=' after key %s", key)
+	}
+	p.next()
+	p.skipSpaces()
+
+	return key, nil
+}
+
+func (p *dotenvParser) parseValue() (string, error) {
+	if p.eof() {
+		return "", nil
+	}
+
+	switch p.peek() {
+	case '"':
+		return p.parseDoubleQuoted()
+	case '\'':
+		return p.parseSingleQuoted()
+	}
+
+	start := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		// a '#' starts a comment only when it follows a space
+		if p.peek() == '#' && p.pos > start && (p.src[p.pos-1] == ' ' || p.src[p.pos-1] == '\t') {
+			break
+		}
+		p.next()
+	}
+	value := strings.TrimSpace(string(p.src[start:p.pos]))
+	p.skipLine()
+
+	return value, nil
+}
+
+func (p *dotenvParser) parseSingleQuoted() (string, error) {
+	line := p.line
+	p.next()
+
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.eof() {
+		p.line = line
+		return "", p.errorf("unterminated single-quoted value")
+	}
+	value := string(p.src[start:p.pos])
+	p.next()
+
+	return value, p.endOfLine()
+}
+
+func (p *dotenvParser) parseDoubleQuoted() (string, error) {
+	line := p.line
+	p.next()
+
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			p.line = line
+			return "", p.errorf("unterminated double-quoted value")
+		}
+
+		c := p.next()
+		switch c {
+		case '"':
+			return sb.String(), p.endOfLine()
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			switch e := p.next(); e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '"', '\\', '$', '\'':
+				sb.WriteByte(e)
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// quoteDotenvValue quotes value when it cannot be written as is to an env
+// file, so that ReadDotenv reads back exactly the same value. Values with
+// double quotes, like JSON, are single-quoted when possible.
+func quoteDotenvValue(value string) string {
+	if value == "" || !strings.ContainsAny(value, " \t\r\n\"'#\\") {
+		return value
+	}
+
+	if strings.Contains(value, `"`) && !strings.ContainsAny(value, "'\r\n") {
+		return "'" + value + "'"
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
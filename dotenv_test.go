@@ -0,0 +1,151 @@
+package emp
+
+import (
+	"errors"
+	"github.com/XMLHexagram/emp/empErr"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tempDir is like t.TempDir, which needs Go 1.15.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "emp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func TestParseDotenv(t *testing.T) {
+	content := `# leading comment
+export EXPORTED=yes
+UNQUOTED = some value # trailing comment
+HASH=a#b
+EMPTY=
+SINGLE='literal \n $HOME # not a comment'
+DOUBLE="tab\there \"quoted\" \\ back" # comment
+MULTILINE="line1
+line2"
+WINDOWS=crlf` + "\r\n"
+
+	expect := MapSource{
+		"EXPORTED":  "yes",
+		"UNQUOTED":  "some value",
+		"HASH":      "a#b",
+		"EMPTY":     "",
+		"SINGLE":    `literal \n $HOME # not a comment`,
+		"DOUBLE":    "tab\there \"quoted\" \\ back",
+		"MULTILINE": "line1\nline2",
+		"WINDOWS":   "crlf",
+	}
+
+	res, err := ParseDotenv(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expect, res)
+}
+
+func TestParseDotenvError(t *testing.T) {
+	dir := tempDir(t)
+	filename := filepath.Join(dir, ".env")
+	err := ioutil.WriteFile(filename, []byte("GOOD=1\n\nBAD VALUE\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadDotenv(filename)
+
+	assert.True(t, errors.Is(err, empErr.DotenvSyntaxError.New()))
+	assert.Contains(t, err.Error(), filename+":3:")
+
+	_, err = ParseDotenv(strings.NewReader("A=\"never closed\nB=2\n"))
+
+	assert.True(t, errors.Is(err, empErr.DotenvSyntaxError.New()))
+	assert.Contains(t, err.Error(), "line 1:")
+
+	for _, content := range []string{"export ", "A=1\nexport\t"} {
+		_, err = ParseDotenv(strings.NewReader(content))
+
+		assert.True(t, errors.Is(err, empErr.DotenvSyntaxError.New()), content)
+		assert.Contains(t, err.Error(), "expected key, got end of input", content)
+	}
+}
+
+func TestReadDotenv(t *testing.T) {
+	dir := tempDir(t)
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	if err := ioutil.WriteFile(base, []byte("A=base\nB=base\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(local, []byte("B=local\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ReadDotenv(base, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, MapSource{"A": "base", "B": "local"}, res)
+
+	_, err = ReadDotenv(filepath.Join(dir, "missing"))
+
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestDotenvRoundTrip(t *testing.T) {
+	type args struct {
+		PLAIN   string
+		SPACES  string
+		QUOTES  string
+		COMMENT string
+		LINES   string
+		FLOAT   float64
+		SLICE   []string
+	}
+
+	input := &args{
+		PLAIN:   "plain",
+		SPACES:  "  padded value ",
+		QUOTES:  `"double" and 'single' \ backslash`,
+		COMMENT: "value # not a comment",
+		LINES:   "line1\nline2\r\n\tline3",
+		FLOAT:   3.1415926535,
+		SLICE:   []string{"lovely", "cute"},
+	}
+
+	out, err := Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := ParseDotenv(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser, err := NewParser(&Config{
+		Source: source,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := new(args)
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, input, res)
+}
@@ -34,6 +34,14 @@
 //         DATABASE_URL string `emp:"DATABASE_DSN"`
 //     }
 //
+// The first part of the tag is always the key, options without a value
+// such as "flag" or "secret" are only recognized after it. Leave the key
+// empty to keep the field name:
+//
+//     type Model struct {
+//         DEBUG bool `emp:",flag"`
+//     }
+//
 // Embedded Structs and Squashing
 //
 // By default, Embedded structs are treated as prefix by their name.
@@ -68,6 +76,219 @@
 // Config has a field that changes the behavior of emp
 // to disable auto prefix.
 //
+// Maps
+//
+// Every entry of a map is a key under the prefix of the map, the rest of
+// the key is the key of the entry:
+//
+//    type Model struct {
+//        LABELS map[string]string
+//    }
+//
+// With environment value:
+//
+//	LABELS_team=core
+//	LABELS_tier=backend
+//
+// Will be converted to:
+//
+//    type Model struct {
+//        LABELS: {"team": "core", "tier": "backend"},
+//    }
+//
+// Entries of a map of structs are a prefix of their own, their names are
+// found by matching the keys against the keys of the struct:
+//
+//    type Model struct {
+//        DB map[string]Db
+//    }
+//
+//    type Db struct {
+//        DSN string
+//    }
+//
+// With environment value:
+//
+//	DB_PRIMARY_DSN=postgres://primary/db
+//	DB_REPLICA_DSN=postgres://replica/db
+//
+// Will be converted to:
+//
+//    type Model struct {
+//        DB: {"PRIMARY": {DSN: "postgres://primary/db"}, "REPLICA": {DSN: "postgres://replica/db"}},
+//    }
+//
+// Map fields need a Source that implements Lister, which all built-in
+// sources do.
+//
+// Tag a map with "map:inline" to read it from a single key instead, split
+// by Config.ParseStringToMap and joined by Config.FormatMapToString:
+//
+//    type Model struct {
+//        HEADERS map[string]string `emp:"map:inline"`
+//    }
+//
+// With environment value:
+//
+//	HEADERS=X-Env:prod,X-Team:core
+//
+// Will be converted to:
+//
+//    type Model struct {
+//        HEADERS: {"X-Env": "prod", "X-Team": "core"},
+//    }
+//
+// Slices of Structs
+//
+// Slices and arrays of structs are read from indexed keys, the indexes
+// must start at 0, be contiguous and have no leading zeros:
+//
+//    type Model struct {
+//        UPSTREAMS []Upstream
+//    }
+//
+//    type Upstream struct {
+//        HOST string
+//        PORT int
+//    }
+//
+// With environment value:
+//
+//	UPSTREAMS_0_HOST=10.0.0.1
+//	UPSTREAMS_0_PORT=8080
+//	UPSTREAMS_1_HOST=10.0.0.2
+//	UPSTREAMS_1_PORT=8081
+//
+// Will be converted to:
+//
+//    type Model struct {
+//        UPSTREAMS: [{HOST: "10.0.0.1", PORT: 8080}, {HOST: "10.0.0.2", PORT: 8081}],
+//    }
+//
+// Durations and Times
+//
+// time.Duration fields are parsed by time.ParseDuration, a plain integer is
+// a number of seconds. time.Time fields are parsed as RFC 3339 by default,
+// use the "layout" tag option to change it, "unix" and "unixmilli" read the
+// time since the Unix epoch:
+//
+//    type Model struct {
+//        HTTP_TIMEOUT time.Duration // 30s, 1m30s, 90
+//        STARTED_AT   time.Time     // 2021-10-17T08:30:00+08:00
+//        EXPIRES_AT   time.Time     `emp:"layout:unix"`       // 1634430600
+//        BIRTHDAY     time.Time     `emp:"layout:2006-01-02"` // 2021-09-01
+//    }
+//
+// Booleans
+//
+// Booleans accept yes/no, on/off, enabled/disabled and the values of
+// strconv.ParseBool, case-insensitive. Config.TrueValues and
+// Config.FalseValues change the vocabulary, Config.StrictBool keeps to
+// strconv.ParseBool. Tag a bool with "flag" to make it true when its key
+// is present, even without a value, and false when it is absent, unless
+// the tag has a default:
+//
+//    type Model struct {
+//        DEBUG bool `emp:",flag"`
+//    }
+//
+// Sizes and Ratios
+//
+// ByteSize fields, and integer fields tagged with "bytesize", accept
+// human-friendly sizes such as 512KB, 200MiB or 1.5G. Percent fields, and
+// float fields tagged with "percent", accept 75% as well as 0.75:
+//
+//    type Model struct {
+//        MAX_SIZE emp.ByteSize // 200MiB
+//        MAX_BODY int64        `emp:",bytesize"` // 1.5MB
+//        SAMPLING emp.Percent  // 75%
+//    }
+//
+// Network Types
+//
+// net.IP, net.IPNet, and on Go 1.18 or later netip.Addr, netip.Prefix and
+// netip.AddrPort are parsed from their usual textual form. Tag a string
+// field with "hostport" to validate a host:port address, the tag option
+// may hold a default port:
+//
+//    type Model struct {
+//        ALLOWED_NETS []net.IPNet // 10.0.0.0/8,fd00::/8
+//        LISTEN       string      `emp:",hostport"`     // :8080
+//        UPSTREAM     string      `emp:"hostport:443"`  // example.com => example.com:443
+//    }
+//
+// URLs
+//
+// url.URL fields are parsed by url.Parse. The "scheme" tag option lists
+// the allowed schemes, "requirehost" rejects URLs without a host. Tag a
+// struct with "url" to decompose a URL into its fields, see URLParts:
+//
+//    type Model struct {
+//        CALLBACK *url.URL     `emp:"scheme:https,requirehost"`
+//        DB_DSN   emp.URLParts `emp:",url,scheme:postgres|postgresql"`
+//    }
+//
+// JSON Values
+//
+// Tag a field with "json" to decode its value with encoding/json, which
+// handles types of any shape, e.g. slices of structs in a single value.
+// Marshal writes such fields as compact JSON:
+//
+//    type Model struct {
+//        FEATURE_MATRIX map[string][]string `emp:",json"`      // {"beta":["search"]}
+//        RULES          []Rule              `emp:"RULES,json"` // [{"path":"/","allow":true}]
+//    }
+//
+// Allowed Values
+//
+// The "oneof" tag option lists the values a field may hold, add
+// "ignorecase" to compare them case-insensitively. Types implementing Enum
+// list their allowed values themselves. Marshal writes the allowed values
+// in a comment above the key:
+//
+//    type Model struct {
+//        LOG_LEVEL string `emp:"oneof:debug|info|warn|error,ignorecase"`
+//        WORKERS   int    `emp:"oneof:1|2|4|8"`
+//    }
+//
+// Interfaces
+//
+// interface{} fields receive the raw string. Implementations of other
+// interfaces are registered with Parser.RegisterType and chosen by a
+// discriminator key, e.g. STORAGE_TYPE=s3 parses the registered struct
+// under the STORAGE_ prefix:
+//
+//    type Model struct {
+//        Storage StorageBackend `emp:"STORAGE"` // STORAGE_TYPE=s3, STORAGE_BUCKET=assets
+//    }
+//
+// Custom Types
+//
+// Types implementing encoding.TextUnmarshaler, like net.IP or big.Int, are
+// parsed by their UnmarshalText method, and marshalled by MarshalText if
+// they implement encoding.TextMarshaler. Implement Unmarshaler and
+// Marshaler to also receive the key of the value.
+//
+// Types you can not add methods to, e.g. from third-party packages, are
+// supported by registering hooks in Config.DecodeHooks and
+// Config.EncodeHooks, which take precedence over everything else:
+//
+//    parser, err := emp.NewParser(&emp.Config{
+//        DecodeHooks: map[reflect.Type]emp.DecodeHookFunc{
+//            reflect.TypeOf(uuid.UUID{}): func(s string) (interface{}, error) {
+//                return uuid.Parse(s)
+//            },
+//        },
+//    })
+//
+// When the same Go type is written in different formats in different
+// fields, register named parsers with Parser.RegisterParser and select
+// them with the "parser" tag option, "base64" and "hex" are built in:
+//
+//    type Model struct {
+//        SECRET_KEY []byte `emp:"parser:base64"`
+//    }
+//
 // Unexported fields
 //
 // Since unexported (private) struct fields cannot be set outside the package
@@ -92,6 +313,79 @@
 //         Public: "SECRET"
 //     }
 //
+// Unset and Empty Values
+//
+// By default a key set to an empty value, like FOO=, is treated as unset
+// and the default value of its field is used. Config.EmptyPolicy makes
+// it count as set, or fail instead. On Go 1.21 or later, Optional fields
+// record whether their key is present at all:
+//
+//    type Model struct {
+//        MAX_CONNS emp.Optional[int] // MAX_CONNS.Present is false when unset
+//    }
+//
+// Set Config.KeepValues to use the values already in the struct as
+// defaults, they are kept when their key is unset:
+//
+//    cfg := Model{PORT: 8080}
+//    parser, err := emp.NewParser(&emp.Config{KeepValues: true})
+//    err = parser.Parse(&cfg)
+//
+// Sources
+//
+// By default, emp reads values from the environment of the current process.
+// Set Config.Source to read them from somewhere else, for example a MapSource
+// in tests, or a ChainSource that asks several sources in order:
+//
+//     parser, err := emp.NewParser(&emp.Config{
+//         Source: emp.ChainSource{
+//             emp.MapSource{"DATABASE_URL": "postgres://localhost/test"},
+//             emp.OSSource{},
+//         },
+//     })
+//
+// Config.Layers stacks sources from the lowest to the highest precedence,
+// set Config.Precedence to FirstLayerWins to flip it:
+//
+//     parser, err := emp.NewParser(&emp.Config{
+//         Layers: []emp.Source{defaults, dotenv, dotenvLocal, emp.OSSource{}},
+//     })
+//
+// Config.ProfileSelector reads the env files of a profile, e.g. with
+// APP_ENV=production, .env, .env.production, .env.local and
+// .env.production.local are read, each one overriding the previous:
+//
+//     parser, err := emp.NewParser(&emp.Config{
+//         ProfileSelector: "APP_ENV",
+//         DefaultProfile:  "development",
+//     })
+//
+// Errors
+//
+// Parse does not stop at the first field that fails, it returns the errors
+// of every failing field together as empErr.Errors, so that all of them
+// can be fixed at once. errors.Is and errors.As look through all of them:
+//
+//    err := emp.Parse(&cfg)
+//    if errors.Is(err, empErr.NotAllowEmptyEnvError) {
+//        // some keys are missing
+//    }
+//
+// Set Config.FailFast to stop at the first error instead.
+//
+// The error of each field is an *empErr.FieldError, which holds its key,
+// its path in the Go struct, e.g. Config.Log.Rotate.MaxSize, its type and
+// its raw value. Tag a field with "secret" to leave its value out:
+//
+//    var fieldErr *empErr.FieldError
+//    if errors.As(err, &fieldErr) {
+//        log.Printf("%s: set %s", fieldErr.Field, fieldErr.Key)
+//    }
+//
+//    type Model struct {
+//        DB_PASSWORD string `emp:",secret"`
+//    }
+//
 // Other Configuration
 //
 // emp is highly configurable. See the Config struct
@@ -102,16 +396,42 @@ import (
 	"fmt"
 	"github.com/XMLHexagram/emp/empErr"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// DefaultTrueValues are the words parsed as true unless Config.TrueValues
+// is set.
+var DefaultTrueValues = []string{"1", "t", "true", "y", "yes", "on", "enable", "enabled"}
+
+// DefaultFalseValues are the words parsed as false unless
+// Config.FalseValues is set.
+var DefaultFalseValues = []string{"0", "f", "false", "n", "no", "off", "disable", "disabled"}
+
 // A Parser takes a raw interface value and fill it data,
 // keeping track of rich error information along the way in case
 // anything goes wrong. You can more finely control how the Parser
 // behaves using the Config structure. The top-level parse
 // method is just a convenience that sets up the most basic Parser.
+//
+// A Parser is safe for concurrent use by multiple goroutines, once
+// RegisterParser and RegisterType are done with. Its Config is copied by
+// NewParser and never changed afterwards, the state of a single call to
+// Marshal lives in a copy of the Parser.
 type Parser struct {
-	config *Config
+	config  *Config
+	source  Source
+	parsers map[string]namedParser
+	types   map[reflect.Type]map[string]reflect.Type
+
+	profile      string
+	profileFiles []string
+
+	// marshal and marshalEntries are the state of a call to Marshal, they
+	// are only set on the copy of the Parser made by Marshal.
+	marshal        bool
+	marshalEntries []marshalEntry
 }
 
 // Config is the configuration that is used to create a new parser
@@ -134,23 +454,136 @@ type Config struct {
 	// AllowEmpty, if set to true, will allow empty values in environment values.
 	AllowEmpty bool
 
+	// RedactValues, if set to true, leaves the raw values out of the
+	// empErr.FieldError of every field, instead of only the fields tagged
+	// with "secret".
+	RedactValues bool
+
+	// FailFast, if set to true, stops at the first field that fails to
+	// parse. By default every field is parsed, and the errors of all the
+	// fields that failed are returned together as empErr.Errors.
+	FailFast bool
+
+	// KeepValues, if set to true, keeps the non-zero values already present
+	// in the struct passed to Parse when their key is unset, so they act as
+	// defaults. They take precedence over the default values of tags.
+	// KeepValues can not be used together with ZeroFields.
+	KeepValues bool
+
+	// EmptyPolicy decides whether a key set to an empty value, like FOO=,
+	// uses the default value, counts as set or is an error. This defaults
+	// to EmptyUsesDefault.
+	EmptyPolicy EmptyPolicy
+
 	// DirectDefault, if set to true, will use the default value in field name directly.
 	DirectDefault bool
 
 	// ParseStringToArrayAndSlice, customize the way split string to array and slice.
 	ParseStringToArrayAndSlice func(s string) []string
 
-	marshal    bool
-	marshalRes string
+	// ParseStringToMap, customize the way split string to map, for map fields
+	// tagged with "map:inline".
+	ParseStringToMap func(s string) (map[string]string, error)
+
+	// FormatMapToString, customize the way Marshal joins a "map:inline"
+	// field, the counterpart of ParseStringToMap. It defaults to
+	// FormatMapToString only when ParseStringToMap is not set either.
+	FormatMapToString func(m map[string]string) (string, error)
+
+	// StrictBool, if set to true, parses booleans with strconv.ParseBool
+	// only, instead of TrueValues and FalseValues.
+	StrictBool bool
+
+	// TrueValues and FalseValues are the words parsed as true and false,
+	// case-insensitive. They default to DefaultTrueValues and
+	// DefaultFalseValues.
+	TrueValues  []string
+	FalseValues []string
+
+	// DecodeHooks, if set, converts values to the types they are registered
+	// for, before emp falls back to its own parsing. This lets third-party
+	// types be parsed without wrapping them.
+	DecodeHooks map[reflect.Type]DecodeHookFunc
+
+	// EncodeHooks, if set, formats values of the types they are registered
+	// for when marshalling, it is the counterpart of DecodeHooks.
+	EncodeHooks map[reflect.Type]EncodeHookFunc
+
+	// Source, if set, is where emp looks up values. This defaults to OSSource,
+	// which reads the environment of the current process.
+	Source Source
+
+	// Layers, if set, stacks several sources on top of each other, listed
+	// from the lowest to the highest precedence, e.g. defaults, .env,
+	// .env.local, the process environment, command line overrides. A key is
+	// resolved by the layer with the highest precedence that has it.
+	// Layers can not be used together with Source.
+	Layers []Source
+
+	// Precedence decides which of the Layers wins when more than one layer
+	// has the same key. This defaults to LastLayerWins.
+	Precedence Precedence
+
+	// ProfileSelector, if set, enables env file profiles. The profile is
+	// the value of the key ProfileSelector (e.g. "APP_ENV"), and the files
+	// .env, .env.<profile>, .env.local and .env.<profile>.local are read
+	// from ProfileDir, each one overriding the previous. Files that do not
+	// exist are skipped. Together they act as the lowest of the Layers.
+	ProfileSelector string
+
+	// DefaultProfile is the profile used when the ProfileSelector key is
+	// not set.
+	DefaultProfile string
+
+	// ProfileDir is the directory where the env files of a profile are
+	// looked for. This defaults to the current working directory.
+	ProfileDir string
 }
 
-// NewParser returns a new parser for the given configuration. Once
-// a parser has been returned, the same configuration must not be used
-// again.
+// clone returns a copy of c that shares none of its slices and maps, so
+// that changes to c do not affect the Parser made from the copy.
+func (c *Config) clone() *Config {
+	res := *c
+
+	if c.TrueValues != nil {
+		res.TrueValues = append([]string{}, c.TrueValues...)
+	}
+	if c.FalseValues != nil {
+		res.FalseValues = append([]string{}, c.FalseValues...)
+	}
+	if c.Layers != nil {
+		res.Layers = append([]Source{}, c.Layers...)
+	}
+	if c.DecodeHooks != nil {
+		res.DecodeHooks = make(map[reflect.Type]DecodeHookFunc, len(c.DecodeHooks))
+		for k, v := range c.DecodeHooks {
+			res.DecodeHooks[k] = v
+		}
+	}
+	if c.EncodeHooks != nil {
+		res.EncodeHooks = make(map[reflect.Type]EncodeHookFunc, len(c.EncodeHooks))
+		for k, v := range c.EncodeHooks {
+			res.EncodeHooks[k] = v
+		}
+	}
+	return &res
+}
+
+// marshalEntry is a key and its value collected by Marshal.
+type marshalEntry struct {
+	key     string
+	value   string
+	comment string
+}
+
+// NewParser returns a new parser for the given configuration. The
+// configuration is copied, so it may be changed and used again for other
+// parsers afterwards.
 func NewParser(config *Config) (*Parser, error) {
 	if config == nil {
 		config = &Config{}
 	}
+	config = config.clone()
 
 	if config.TagName == "" {
 		config.TagName = "emp"
@@ -160,9 +593,85 @@ func NewParser(config *Config) (*Parser, error) {
 		config.ParseStringToArrayAndSlice = ParseStringToArrayAndSlice
 	}
 
-	return &Parser{
-		config: config,
-	}, nil
+	if config.TrueValues == nil {
+		config.TrueValues = DefaultTrueValues
+	}
+
+	if config.FalseValues == nil {
+		config.FalseValues = DefaultFalseValues
+	}
+
+	if config.ParseStringToMap == nil {
+		config.ParseStringToMap = ParseStringToMap
+		if config.FormatMapToString == nil {
+			config.FormatMapToString = FormatMapToString
+		}
+	}
+
+	if config.KeepValues && config.ZeroFields {
+		return nil, empErr.InvalidConfigError.New().Wrap("KeepValues and ZeroFields can not be set at the same time")
+	}
+
+	if config.Source != nil && len(config.Layers) > 0 {
+		return nil, empErr.InvalidConfigError.New().Wrap("Source and Layers can not be set at the same time")
+	}
+
+	if config.Source == nil && len(config.Layers) == 0 {
+		config.Source = OSSource{}
+	}
+
+	layers := config.Layers
+	if len(layers) == 0 {
+		layers = []Source{config.Source}
+	}
+
+	parser := &Parser{
+		config:  config,
+		parsers: make(map[string]namedParser, len(builtinParsers)),
+		types:   make(map[reflect.Type]map[string]reflect.Type),
+	}
+
+	for name, builtin := range builtinParsers {
+		parser.parsers[name] = builtin
+	}
+
+	if config.ProfileSelector != "" {
+		profile, _ := stackLayers(layers, config.Precedence).Lookup(config.ProfileSelector)
+		if profile == "" {
+			profile = config.DefaultProfile
+		}
+
+		files, dotenv, err := readProfile(config.ProfileDir, profile)
+		if err != nil {
+			return nil, err
+		}
+
+		parser.profile = profile
+		parser.profileFiles = files
+		// the env files are the lowest layer, whichever end that is
+		if config.Precedence == FirstLayerWins {
+			layers = append(append([]Source(nil), layers...), dotenv)
+		} else {
+			layers = append([]Source{dotenv}, layers...)
+		}
+	}
+
+	parser.source = stackLayers(layers, config.Precedence)
+
+	return parser, nil
+}
+
+// Profile returns the profile selected by Config.ProfileSelector, or an
+// empty string if there is none.
+func (p *Parser) Profile() string {
+	return p.profile
+}
+
+// ProfileFiles returns the env files that were read for the profile
+// selected by Config.ProfileSelector, that is the ones that exist, even if
+// they are empty.
+func (p *Parser) ProfileFiles() []string {
+	return append([]string(nil), p.profileFiles...)
 }
 
 // Parse takes an input structure and uses reflection to translate it to
@@ -193,93 +702,296 @@ func Marshal(inputPtrInterface interface{}) (string, error) {
 // Parse parses the given raw interface to the target pointer specified
 // by the configuration.
 func (p *Parser) Parse(StructPtrInterface interface{}) error {
-	return p.parse(p.config.Prefix, "", "", p.config.DirectDefault, reflect.ValueOf(StructPtrInterface).Elem())
+	val := reflect.ValueOf(StructPtrInterface).Elem()
+	err := p.parse(p.config.Prefix, "", "", p.config.DirectDefault, nil, val)
+	if err != nil && val.Type().Name() != "" {
+		prependField(err, val.Type().Name())
+	}
+	return err
 }
 
 // Marshal struct to get an env file format string.
 func (p *Parser) Marshal(StructPtrInterface interface{}) (string, error) {
-	p.config.marshal = true
-	p.config.marshalRes = ""
-	defer func() {
-		p.config.marshal = false
-		p.config.marshalRes = ""
-	}()
-	err := p.parse(p.config.Prefix, "", "", p.config.DirectDefault, reflect.ValueOf(StructPtrInterface).Elem())
+	// the state of the call lives in a copy, so that p can be shared
+	parser := *p
+	parser.marshal = true
+	parser.marshalEntries = nil
+
+	err := parser.parse(p.config.Prefix, "", "", p.config.DirectDefault, nil, reflect.ValueOf(StructPtrInterface).Elem())
 	if err != nil {
 		return "", err
 	}
-	return p.config.marshalRes, nil
+
+	var sb strings.Builder
+	for _, entry := range parser.marshalEntries {
+		if entry.comment != "" {
+			sb.WriteString("# " + entry.comment + "\n")
+		}
+		sb.WriteString(entry.key + "=" + quoteDotenvValue(entry.value) + "\n")
+	}
+	return sb.String(), nil
+}
+
+// marshalEnv appends a key and its value to the marshal result.
+func (p *Parser) marshalEnv(key string, value string) {
+	p.marshalEntries = append(p.marshalEntries, marshalEntry{key: key, value: value})
+}
+
+// marshalValue returns the entries that marshal val without a prefix.
+func (p *Parser) marshalValue(opts tagOptions, val reflect.Value) ([]marshalEntry, error) {
+	parser := *p
+	parser.marshal = true
+	parser.marshalEntries = nil
+
+	err := parser.parse("", "", "", false, opts, val)
+	if err != nil {
+		return nil, err
+	}
+	return parser.marshalEntries, nil
+}
+
+// typeKeys returns the keys that parsing a value of type valType without a
+// prefix would look up.
+func (p *Parser) typeKeys(valType reflect.Type) ([]string, error) {
+	for valType.Kind() == reflect.Ptr {
+		valType = valType.Elem()
+	}
+
+	entries, err := p.marshalValue(nil, reflect.New(valType).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, len(entries))
+	for i, entry := range entries {
+		res[i] = entry.key
+	}
+	return res, nil
+}
+
+// formatValue returns the single value that marshal val, e.g. the elements
+// of a slice.
+func (p *Parser) formatValue(opts tagOptions, val reflect.Value) (string, error) {
+	entries, err := p.marshalValue(opts, val)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 {
+		return "", empErr.UnsupportedTypeError.New().Wrap(fmt.Sprintf("%s can not be formatted as a single value", val.Type()))
+	}
+	return entries[0].value, nil
+}
+
+// formatSliceAndArray returns the elements of a slice or an array as a
+// comma separated string.
+func (p *Parser) formatSliceAndArray(opts tagOptions, val reflect.Value) (string, error) {
+	res := make([]string, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		v, err := p.formatValue(opts, val.Index(i))
+		if err != nil {
+			return "", err
+		}
+		res[i] = v
+	}
+	return strings.Join(res, ","), nil
+}
+
+// formatMap returns the entries of a map as comma separated key:value
+// pairs.
+func (p *Parser) formatMap(opts tagOptions, val reflect.Value) (string, error) {
+	if p.config.FormatMapToString == nil {
+		return "", empErr.UnsupportedTypeError.New().Wrap("inline map needs Config.FormatMapToString when Config.ParseStringToMap is set")
+	}
+
+	dataMap := make(map[string]string, val.Len())
+	iter := val.MapRange()
+	for iter.Next() {
+		k, err := p.formatValue(nil, iter.Key())
+		if err != nil {
+			return "", err
+		}
+		v, err := p.formatValue(opts, iter.Value())
+		if err != nil {
+			return "", err
+		}
+		dataMap[k] = v
+	}
+
+	res, err := p.config.FormatMapToString(dataMap)
+	if err != nil {
+		return "", empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+	return res, nil
 }
 
 // parse environment value to specific reflection value.
-func (p *Parser) parse(prefix string, name string, default_ string, directDefault bool, outVal reflect.Value) error {
+func (p *Parser) parse(prefix string, name string, default_ string, directDefault bool, opts tagOptions, outVal reflect.Value) error {
+	if !outVal.IsValid() {
+		return p.parseValue(prefix, name, default_, directDefault, opts, outVal)
+	}
+
+	if !p.marshal && !directDefault && p.keepValue(outVal) && p.isSingleKey(outVal.Type(), opts) {
+		if _, ok := p.lookup(prefix + name); !ok {
+			return nil
+		}
+	}
+
+	allowed := allowedValues(opts, outVal.Type())
+	if allowed == nil {
+		return p.parseValue(prefix, name, default_, directDefault, opts, outVal)
+	}
+
+	if p.marshal {
+		n := len(p.marshalEntries)
+		err := p.parseValue(prefix, name, default_, directDefault, opts, outVal)
+		if err == nil && len(p.marshalEntries) > n {
+			p.marshalEntries[n].comment = "one of: " + strings.Join(allowed, ", ")
+		}
+		return err
+	}
+
+	err := p.parseValue(prefix, name, default_, directDefault, opts, outVal)
+	if err != nil || !isEnumKind(outVal.Kind()) {
+		return err
+	}
+
+	// a key that is absent and has no default is not checked
+	if !directDefault && default_ == "" {
+		if _, ok := p.source.Lookup(prefix + name); !ok {
+			return nil
+		}
+	}
+	return p.checkEnum(prefix+name, opts, allowed, outVal)
+}
+
+func (p *Parser) parseValue(prefix string, name string, default_ string, directDefault bool, opts tagOptions, outVal reflect.Value) error {
 	var err error
+
+	if outVal.IsValid() {
+		if outVal.CanAddr() && isOptionalType(outVal.Type()) {
+			return p.parseOptional(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if _, ok := opts["json"]; ok {
+			return p.parseJSON(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if ok, err := p.parseNamed(prefix, name, default_, directDefault, opts, outVal); ok {
+			return err
+		}
+
+		if ok, err := p.parseHook(prefix, name, default_, directDefault, opts, outVal); ok {
+			return err
+		}
+
+		switch outVal.Type() {
+		case durationType:
+			return p.parseDuration(prefix, name, default_, directDefault, opts, outVal)
+		case timeType:
+			return p.parseTime(prefix, name, default_, directDefault, opts, outVal)
+		case ipNetType:
+			return p.parseIPNet(prefix, name, default_, directDefault, opts, outVal)
+		case urlType:
+			return p.parseURL(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if _, ok := opts["bytesize"]; ok && outVal.Kind() >= reflect.Int && outVal.Kind() <= reflect.Uint64 {
+			return p.parseByteSize(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if _, ok := opts["percent"]; ok && (outVal.Kind() == reflect.Float32 || outVal.Kind() == reflect.Float64) {
+			return p.parsePercent(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if _, ok := opts["url"]; ok && outVal.Kind() == reflect.Struct {
+			return p.parseURLParts(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if _, ok := opts["hostport"]; ok && outVal.Kind() == reflect.String {
+			return p.parseHostPort(prefix, name, default_, directDefault, opts, outVal)
+		}
+
+		if ok, err := p.parseUnmarshaler(prefix, name, default_, directDefault, opts, outVal); ok {
+			return err
+		}
+	}
+
 	outValKind := getKind(outVal)
 	switch outValKind {
 	case reflect.Bool:
-		err = p.parseBool(prefix, name, default_, directDefault, outVal)
+		err = p.parseBool(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Int:
-		err = p.parseIntX(prefix, name, default_, directDefault, outVal, 0)
+		err = p.parseIntX(prefix, name, default_, directDefault, opts, outVal, 0)
 	case reflect.Int8:
-		err = p.parseIntX(prefix, name, default_, directDefault, outVal, 8)
+		err = p.parseIntX(prefix, name, default_, directDefault, opts, outVal, 8)
 	case reflect.Int16:
-		err = p.parseIntX(prefix, name, default_, directDefault, outVal, 16)
+		err = p.parseIntX(prefix, name, default_, directDefault, opts, outVal, 16)
 	case reflect.Int32:
-		err = p.parseIntX(prefix, name, default_, directDefault, outVal, 32)
+		err = p.parseIntX(prefix, name, default_, directDefault, opts, outVal, 32)
 	case reflect.Int64:
-		err = p.parseIntX(prefix, name, default_, directDefault, outVal, 64)
+		err = p.parseIntX(prefix, name, default_, directDefault, opts, outVal, 64)
 	case reflect.Uint:
-		err = p.parseUintX(prefix, name, default_, directDefault, outVal, 0)
+		err = p.parseUintX(prefix, name, default_, directDefault, opts, outVal, 0)
 	case reflect.Uint8:
-		err = p.parseUintX(prefix, name, default_, directDefault, outVal, 8)
+		err = p.parseUintX(prefix, name, default_, directDefault, opts, outVal, 8)
 	case reflect.Uint16:
-		err = p.parseUintX(prefix, name, default_, directDefault, outVal, 16)
+		err = p.parseUintX(prefix, name, default_, directDefault, opts, outVal, 16)
 	case reflect.Uint32:
-		err = p.parseUintX(prefix, name, default_, directDefault, outVal, 32)
+		err = p.parseUintX(prefix, name, default_, directDefault, opts, outVal, 32)
 	case reflect.Uint64:
-		err = p.parseUintX(prefix, name, default_, directDefault, outVal, 64)
+		err = p.parseUintX(prefix, name, default_, directDefault, opts, outVal, 64)
 	case reflect.Float32:
-		err = p.parseFloatX(prefix, name, default_, directDefault, outVal, 32)
+		err = p.parseFloatX(prefix, name, default_, directDefault, opts, outVal, 32)
 	case reflect.Float64:
-		err = p.parseFloatX(prefix, name, default_, directDefault, outVal, 64)
+		err = p.parseFloatX(prefix, name, default_, directDefault, opts, outVal, 64)
 	case reflect.String:
-		err = p.parseString(prefix, name, default_, directDefault, outVal)
+		err = p.parseString(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Ptr:
-		err = p.parsePointer(prefix, name, default_, directDefault, outVal)
+		err = p.parsePointer(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Map:
-		// TODO: wait for a great way
-		err = p.parseMap(prefix, name, default_, outVal)
+		err = p.parseMap(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Struct:
-		err = p.parseStruct(prefix, name, default_, directDefault, outVal)
+		err = p.parseStruct(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Array:
-		err = p.parseArray(prefix, name, default_, directDefault, outVal)
+		err = p.parseArray(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Slice:
-		err = p.parseSlice(prefix, name, default_, directDefault, outVal)
+		err = p.parseSlice(prefix, name, default_, directDefault, opts, outVal)
 	case reflect.Interface:
-		err = p.parseInterface(prefix, name, default_, directDefault, outVal)
+		err = p.parseInterface(prefix, name, default_, directDefault, opts, outVal)
 	}
 
 	return err
 }
 
-func (p *Parser) parseBool(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+func (p *Parser) parseBool(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	val = reflect.Indirect(val)
 	// valType := val.Type()
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%t\n", prefix+name, val.Bool())
+	if p.marshal {
+		p.marshalEnv(prefix+name, strconv.FormatBool(val.Bool()))
 		return nil
 	}
 
 	var value bool
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+
+	// a flag is true when its key is present, even without a value, and
+	// takes the default of its tag when it is absent
+	if _, isFlag := opts["flag"]; isFlag && !directDefault {
+		envString, ok := p.source.Lookup(key)
+		if (ok && envString == "") || (!ok && default_ == "") {
+			val.SetBool(ok)
+			return nil
+		}
+	}
+
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
 
-	value, err = strconv.ParseBool(envString)
+	value, err = p.parseBoolString(envString)
 	if err != nil {
 		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
 	}
@@ -288,19 +1000,38 @@ func (p *Parser) parseBool(prefix string, name string, default_ string, directDe
 	return nil
 }
 
-func (p *Parser) parseString(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+// parseBoolString parses s with the boolean vocabulary of the Config.
+func (p *Parser) parseBoolString(s string) (bool, error) {
+	if p.config.StrictBool {
+		return strconv.ParseBool(s)
+	}
+
+	for _, v := range p.config.TrueValues {
+		if strings.EqualFold(s, v) {
+			return true, nil
+		}
+	}
+	for _, v := range p.config.FalseValues {
+		if strings.EqualFold(s, v) {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+func (p *Parser) parseString(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	val = reflect.Indirect(val)
 	// valType := val.Type()
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%s\n", prefix+name, val.String())
+	if p.marshal {
+		p.marshalEnv(prefix+name, val.String())
 		return nil
 	}
 
 	var value string
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
@@ -311,14 +1042,14 @@ func (p *Parser) parseString(prefix string, name string, default_ string, direct
 	return nil
 }
 
-func (p *Parser) parsePointer(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+func (p *Parser) parsePointer(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	// Create an element of the concrete (non pointer) type and decode
 	// into that. Then set the value of the pointer to this type.
 	valType := val.Type()
 	valElemType := valType.Elem()
 
-	if p.config.marshal {
-		err := p.parse(prefix, name, "", directDefault, reflect.Indirect(val))
+	if p.marshal {
+		err := p.parse(prefix, name, default_, directDefault, opts, reflect.Indirect(val))
 		return err
 	}
 
@@ -328,14 +1059,14 @@ func (p *Parser) parsePointer(prefix string, name string, default_ string, direc
 			realVal = reflect.New(valElemType)
 		}
 
-		err := p.parse(prefix, name, "", directDefault, reflect.Indirect(realVal))
+		err := p.parse(prefix, name, default_, directDefault, opts, reflect.Indirect(realVal))
 		if err != nil {
 			return err
 		}
 
 		val.Set(realVal)
 	} else {
-		err := p.parse(prefix, name, "", directDefault, reflect.Indirect(val))
+		err := p.parse(prefix, name, default_, directDefault, opts, reflect.Indirect(val))
 		if err != nil {
 			return err
 		}
@@ -344,16 +1075,20 @@ func (p *Parser) parsePointer(prefix string, name string, default_ string, direc
 	return nil
 }
 
-func (p *Parser) parseStruct(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+func (p *Parser) parseStruct(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	val = reflect.Indirect(val)
 	valType := val.Type()
+
+	// Accumulate any errors
+	var errs empErr.Errors
+
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Field(i)
 		if !field.CanSet() {
 			continue
 		}
 		fieldName := valType.Field(i).Name
-		tagPrefix, name, default_, isIgnore := parseTagString(valType.Field(i).Tag.Get(p.config.TagName))
+		tagPrefix, name, default_, isIgnore, opts := parseTagString(valType.Field(i).Tag.Get(p.config.TagName))
 
 		if name == "" {
 			name = fieldName
@@ -364,31 +1099,34 @@ func (p *Parser) parseStruct(prefix string, name string, default_ string, direct
 		}
 
 		// auto prefix
-		if field.Type().Kind() == reflect.Struct && tagPrefix == "" && p.config.AutoPrefix {
+		if field.Type().Kind() == reflect.Struct && p.isNestedField(field.Type(), opts) && tagPrefix == "" && p.config.AutoPrefix {
 			prefix = name
 		}
 
-		err := p.parse(prefix+tagPrefix, name, default_, directDefault, field)
+		err := p.parse(prefix+tagPrefix, name, default_, directDefault, opts, field)
 		if err != nil {
-			return err
+			errs = errs.Append(p.wrapFieldError(err, fieldName, prefix+tagPrefix+name, default_, opts, field.Type()))
+			if p.config.FailFast {
+				break
+			}
 		}
 	}
-	return nil
+	return errs.Err()
 }
 
-func (p *Parser) parseFloatX(prefix string, name string, default_ string, directDefault bool, val reflect.Value, X int) error {
+func (p *Parser) parseFloatX(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value, X int) error {
 	val = reflect.Indirect(val)
 	// valType := val.Type()
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%f", prefix+name, val.Float())
+	if p.marshal {
+		p.marshalEnv(prefix+name, strconv.FormatFloat(val.Float(), 'f', -1, X))
 		return nil
 	}
 
 	var value float64
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
@@ -402,19 +1140,19 @@ func (p *Parser) parseFloatX(prefix string, name string, default_ string, direct
 	return nil
 }
 
-func (p *Parser) parseIntX(prefix string, name string, default_ string, directDefault bool, val reflect.Value, X int) error {
+func (p *Parser) parseIntX(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value, X int) error {
 	val = reflect.Indirect(val)
 	// valType := val.Type()
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%d\n", prefix+name, val.Int())
+	if p.marshal {
+		p.marshalEnv(prefix+name, strconv.FormatInt(val.Int(), 10))
 		return nil
 	}
 
 	var value int64
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
@@ -428,19 +1166,19 @@ func (p *Parser) parseIntX(prefix string, name string, default_ string, directDe
 	return nil
 }
 
-func (p *Parser) parseUintX(prefix string, name string, default_ string, directDefault bool, val reflect.Value, X int) error {
+func (p *Parser) parseUintX(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value, X int) error {
 	val = reflect.Indirect(val)
 	// valType := val.Type()
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%d\n", prefix+name, val.Uint())
+	if p.marshal {
+		p.marshalEnv(prefix+name, strconv.FormatUint(val.Uint(), 10))
 		return nil
 	}
 
 	var value uint64
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
@@ -454,24 +1192,226 @@ func (p *Parser) parseUintX(prefix string, name string, default_ string, directD
 	return nil
 }
 
-func (p *Parser) parseMap(prefix string, name string, default_ string, val reflect.Value) error {
-	return empErr.UnsupportedTypeError.New().Wrap("map type is not supported")
+func (p *Parser) parseMap(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	switch opts["map"] {
+	case "", "keys":
+	case "inline":
+		return p.parseInlineMap(prefix, name, default_, directDefault, opts, val)
+	default:
+		return empErr.UnsupportedTypeError.New().Wrap("unknown map mode: " + opts["map"])
+	}
+
+	valType := val.Type()
+	valKeyType := valType.Key()
+	valElemType := valType.Elem()
+
+	// every entry of the map is a key under the prefix of the map itself,
+	// e.g. LABELS_team=x and LABELS_tier=y for the map LABELS. Struct
+	// entries are a prefix of their own, e.g. DB_PRIMARY_DSN for the DSN
+	// of the entry PRIMARY of the map DB.
+	entryPrefix := mapEntryPrefix(prefix + name)
+	nested := p.isNestedType(valElemType)
+
+	parseEntry := func(entryName string, elem reflect.Value) error {
+		if nested {
+			return p.parse(mapEntryPrefix(entryPrefix+entryName), "", "", false, opts, elem)
+		}
+		return p.parse(entryPrefix, entryName, "", false, opts, elem)
+	}
+
+	if p.marshal {
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprintf("%v", keys[i].Interface()) < fmt.Sprintf("%v", keys[j].Interface())
+		})
+		for _, k := range keys {
+			elem := reflect.New(valElemType).Elem()
+			elem.Set(val.MapIndex(k))
+			err := parseEntry(fmt.Sprintf("%v", k.Interface()), elem)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if directDefault {
+		return nil
+	}
+
+	lister, ok := p.source.(Lister)
+	if !ok {
+		return empErr.UnsupportedTypeError.New().Wrap("map type needs a Source that implements Lister")
+	}
+
+	entryNames, err := p.mapEntryNames(entryPrefix, valElemType, lister.Keys())
+	if err != nil {
+		return err
+	}
+
+	if len(entryNames) == 0 && p.keepValue(val) {
+		return nil
+	}
+
+	if len(entryNames) == 0 && !p.config.AllowEmpty {
+		return empErr.NotAllowEmptyEnvError.New().Wrap("miss environment key: " + entryPrefix + "*")
+	}
+
+	valMap := val
+	if valMap.IsNil() || p.config.ZeroFields {
+		valMap = reflect.MakeMap(valType)
+	}
+
+	// Accumulate any errors
+	var errs empErr.Errors
+
+	for _, entryName := range entryNames {
+		k := reflect.New(valKeyType).Elem()
+		elem := reflect.New(valElemType).Elem()
+
+		err := p.parse("", "", entryName, true, nil, k)
+		if err != nil {
+			err = p.wrapFieldError(err, "["+entryName+"]", entryPrefix+entryName, "", opts, valKeyType)
+		} else if err = parseEntry(entryName, elem); err != nil {
+			err = p.wrapFieldError(err, "["+entryName+"]", entryPrefix+entryName, "", opts, valElemType)
+		} else {
+			valMap.SetMapIndex(k, elem)
+			continue
+		}
+
+		errs = errs.Append(err)
+		if p.config.FailFast {
+			break
+		}
+	}
+
+	val.Set(valMap)
+	return errs.Err()
+}
+
+// parseInlineMap parses a map from a single key, e.g. HEADERS=X-Env:prod,X-Team:core.
+func (p *Parser) parseInlineMap(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	valType := val.Type()
+	valKeyType := valType.Key()
+	valElemType := valType.Elem()
+
+	if p.marshal {
+		value, err := p.formatMap(opts, val)
+		if err != nil {
+			return err
+		}
+		p.marshalEnv(prefix+name, value)
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	dataMap, err := p.config.ParseStringToMap(envString)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	valMap := val
+	if valMap.IsNil() || p.config.ZeroFields {
+		valMap = reflect.MakeMap(valType)
+	}
+
+	dataKeys := make([]string, 0, len(dataMap))
+	for k := range dataMap {
+		dataKeys = append(dataKeys, k)
+	}
+	sort.Strings(dataKeys)
+
+	// Accumulate any errors
+	var errs empErr.Errors
+
+	for _, k := range dataKeys {
+		keyVal := reflect.New(valKeyType).Elem()
+		err := p.parse("", "", k, true, nil, keyVal)
+		if err == nil {
+			elem := reflect.New(valElemType).Elem()
+			err = p.parse("", "", dataMap[k], true, opts, elem)
+			if err == nil {
+				valMap.SetMapIndex(keyVal, elem)
+				continue
+			}
+		}
+
+		errs = errs.Append(err)
+		if p.config.FailFast {
+			break
+		}
+	}
+
+	val.Set(valMap)
+	return errs.Err()
 }
 
-func (p *Parser) parseArray(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+// mapEntryNames finds the names of the entries of a map in keys. For maps
+// of structs, the names are found by matching the keys against the keys of
+// the struct, so that DB_PRIMARY_DSN and DB_REPLICA_DSN give PRIMARY and
+// REPLICA.
+func (p *Parser) mapEntryNames(entryPrefix string, valElemType reflect.Type, keys []string) ([]string, error) {
+	var elemKeys []string
+	if p.isNestedType(valElemType) {
+		var err error
+		elemKeys, err = p.typeKeys(valElemType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, entryPrefix) || len(k) == len(entryPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, entryPrefix)
+
+		if elemKeys == nil {
+			res = append(res, rest)
+			continue
+		}
+
+		for _, elemKey := range elemKeys {
+			entryName := strings.TrimSuffix(rest, "_"+elemKey)
+			if entryName != rest && entryName != "" && !seen[entryName] {
+				seen[entryName] = true
+				res = append(res, entryName)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (p *Parser) parseArray(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	valType := val.Type()
 	valElemType := valType.Elem()
 	arrayType := reflect.ArrayOf(valType.Len(), valElemType)
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%v\n", prefix+name, formatSliceAndArrayReflectValue(val))
+	if p.isNestedType(valElemType) {
+		return p.parseIndexed(prefix, name, directDefault, opts, val)
+	}
+
+	if p.marshal {
+		value, err := p.formatSliceAndArray(opts, val)
+		if err != nil {
+			return err
+		}
+		p.marshalEnv(prefix+name, value)
 		return nil
 	}
 
 	valArray := val
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
@@ -488,30 +1428,37 @@ func (p *Parser) parseArray(prefix string, name string, default_ string, directD
 	}
 
 	// Accumulate any errors
-	errors := make([]string, 0)
+	var errs empErr.Errors
 
 	for i, v := range dataSlice {
-		err := p.parse("", "", v, true, valArray.Index(i))
+		err := p.parse("", "", v, true, opts, valArray.Index(i))
 		if err != nil {
-			errors = append(errors, err.Error())
+			errs = errs.Append(err)
+			if p.config.FailFast {
+				break
+			}
 		}
 	}
 
 	val.Set(valArray)
-
-	if len(errors) > 0 {
-		return empErr.CannotParseEnvStringToTypeError.New().Wrap(errors)
-	}
-	return nil
+	return errs.Err()
 }
 
-func (p *Parser) parseSlice(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+func (p *Parser) parseSlice(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	valType := val.Type()
 	valElemType := valType.Elem()
 	sliceType := reflect.SliceOf(valElemType)
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%v\n", prefix+name, formatSliceAndArrayReflectValue(val))
+	if p.isNestedType(valElemType) {
+		return p.parseIndexed(prefix, name, directDefault, opts, val)
+	}
+
+	if p.marshal {
+		value, err := p.formatSliceAndArray(opts, val)
+		if err != nil {
+			return err
+		}
+		p.marshalEnv(prefix+name, value)
 		return nil
 	}
 
@@ -522,7 +1469,7 @@ func (p *Parser) parseSlice(prefix string, name string, default_ string, directD
 	}
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
@@ -530,7 +1477,7 @@ func (p *Parser) parseSlice(prefix string, name string, default_ string, directD
 	dataSlice := p.config.ParseStringToArrayAndSlice(envString)
 
 	// Accumulate any errors
-	errors := make([]string, 0)
+	var errs empErr.Errors
 
 	for i, v := range dataSlice {
 		for valSlice.Len() <= i {
@@ -538,33 +1485,130 @@ func (p *Parser) parseSlice(prefix string, name string, default_ string, directD
 		}
 		currentField := valSlice.Index(i)
 
-		err := p.parse("", "", v, true, currentField)
+		err := p.parse("", "", v, true, opts, currentField)
 		if err != nil {
-			errors = append(errors, err.Error())
+			errs = errs.Append(err)
+			if p.config.FailFast {
+				break
+			}
 		}
 	}
 
 	val.Set(valSlice)
+	return errs.Err()
+}
 
-	if len(errors) > 0 {
-		return empErr.CannotParseEnvStringToTypeError.New().Wrap(errors)
+// parseIndexed parses a slice or an array of structs from indexed keys,
+// e.g. UPSTREAMS_0_HOST and UPSTREAMS_1_HOST for the slice UPSTREAMS.
+func (p *Parser) parseIndexed(prefix string, name string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	valType := val.Type()
+	valElemType := valType.Elem()
+	entryPrefix := mapEntryPrefix(prefix + name)
+
+	if p.marshal {
+		for i := 0; i < val.Len(); i++ {
+			err := p.parse(mapEntryPrefix(entryPrefix+strconv.Itoa(i)), "", "", directDefault, opts, val.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return nil
+
+	if directDefault {
+		return nil
+	}
+
+	lister, ok := p.source.(Lister)
+	if !ok {
+		return empErr.UnsupportedTypeError.New().Wrap("slice of struct type needs a Source that implements Lister")
+	}
+
+	entryNames, err := p.mapEntryNames(entryPrefix, valElemType, lister.Keys())
+	if err != nil {
+		return err
+	}
+
+	indexes := make([]int, 0, len(entryNames))
+	for _, entryName := range entryNames {
+		index, err := strconv.Atoi(entryName)
+		if err != nil || index < 0 || strconv.Itoa(index) != entryName {
+			return empErr.MissingIndexError.New().Wrap(fmt.Sprintf("'%s': invalid index %q", entryPrefix, entryName))
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for i, index := range indexes {
+		if index != i {
+			return empErr.MissingIndexError.New().Wrap(fmt.Sprintf("'%s': missing index %d, found index %d", entryPrefix, i, index))
+		}
+	}
+
+	if len(indexes) == 0 && p.keepValue(val) {
+		return nil
+	}
+
+	if len(indexes) == 0 && !p.config.AllowEmpty {
+		return empErr.NotAllowEmptyEnvError.New().Wrap("miss environment key: " + entryPrefix + "0_*")
+	}
+
+	res := val
+	if valType.Kind() == reflect.Array {
+		if len(indexes) > val.Len() {
+			return empErr.
+				ArraySizeMismatchError.New().Wrap(fmt.Sprintf("'%s': expected source data to have length less or equal to %d, got %d", name, val.Len(), len(indexes)))
+		}
+		if p.config.ZeroFields {
+			res = reflect.New(valType).Elem()
+		}
+	} else {
+		if res.IsNil() || p.config.ZeroFields {
+			res = reflect.MakeSlice(valType, 0, len(indexes))
+		}
+		for res.Len() < len(indexes) {
+			res = reflect.Append(res, reflect.Zero(valElemType))
+		}
+	}
+
+	// Accumulate any errors
+	var errs empErr.Errors
+
+	for i := range indexes {
+		err := p.parse(mapEntryPrefix(entryPrefix+strconv.Itoa(i)), "", "", false, opts, res.Index(i))
+		if err != nil {
+			errs = errs.Append(p.wrapFieldError(err, "["+strconv.Itoa(i)+"]", entryPrefix+strconv.Itoa(i), "", opts, valElemType))
+			if p.config.FailFast {
+				break
+			}
+		}
+	}
+
+	val.Set(res)
+	return errs.Err()
 }
 
-func (p *Parser) parseInterface(prefix string, name string, default_ string, directDefault bool, val reflect.Value) error {
+func (p *Parser) parseInterface(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
 	val = reflect.Indirect(val)
-	// valType := val.Type()
+	valType := val.Type()
+
+	if len(p.types[valType]) > 0 {
+		return p.parseRegistered(prefix, name, default_, directDefault, opts, val)
+	}
+
+	if valType.NumMethod() > 0 {
+		return empErr.UnsupportedTypeError.New().Wrap(fmt.Sprintf("no type registered for %v", valType))
+	}
 
-	if p.config.marshal {
-		p.config.marshalRes += fmt.Sprintf("%s=%v\n", prefix+name, val.Interface())
+	if p.marshal {
+		p.marshalEnv(prefix+name, fmt.Sprintf("%v", val.Interface()))
 		return nil
 	}
 
 	var value string
 
 	key := prefix + name
-	envString, err := getEnvString(key, default_, directDefault, p.config.AllowEmpty)
+	envString, err := p.getEnvString(key, default_, directDefault)
 	if err != nil {
 		return err
 	}
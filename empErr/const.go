@@ -6,8 +6,14 @@ const (
 	CannotParseEnvStringToTypeError Identifier = "CannotParseEnvStringToTypeError"
 	UnsupportedTypeError            Identifier = "UnsupportedTypeError"
 	ArraySizeMismatchError          Identifier = "ArraySizeMismatchError"
+	DotenvSyntaxError               Identifier = "DotenvSyntaxError"
+	InvalidConfigError              Identifier = "InvalidConfigError"
+	MissingIndexError               Identifier = "MissingIndexError"
+	NotAllowedValueError            Identifier = "NotAllowedValueError"
 )
 
+// ErrorMap lists an *Error of every identifier. Identifier.New does not
+// return these values, it returns a new *Error every time.
 var ErrorMap = map[Identifier]*Error{
 	MustError: {
 		Identifier: MustError,
@@ -24,4 +30,16 @@ var ErrorMap = map[Identifier]*Error{
 	ArraySizeMismatchError: {
 		Identifier: ArraySizeMismatchError,
 	},
+	DotenvSyntaxError: {
+		Identifier: DotenvSyntaxError,
+	},
+	InvalidConfigError: {
+		Identifier: InvalidConfigError,
+	},
+	MissingIndexError: {
+		Identifier: MissingIndexError,
+	},
+	NotAllowedValueError: {
+		Identifier: NotAllowedValueError,
+	},
 }
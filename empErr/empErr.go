@@ -16,34 +16,53 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("identifier: %s, payload: %s", e.Identifier, e.Payload)
 }
 
+// Is reports whether target is an *Error or an Identifier with the same
+// identifier as e.
 func (e *Error) Is(target error) bool {
-	if target == nil {
-		return false
+	switch target := target.(type) {
+	case *Error:
+		return target != nil && target.Identifier == e.Identifier
+	case Identifier:
+		return target == e.Identifier
 	}
-	err, ok := target.(*Error)
-	if !ok {
-		return false
-	}
-	return err.Identifier == e.Identifier
+	return false
 }
 
 func (e *Error) Unwrap() error {
 	return e.Payload
 }
 
+// Wrap sets data as the payload of e and returns e. data may be a string,
+// an error, or a []string of aggregated messages, which is wrapped as
+// Errors.
 func (e *Error) Wrap(data interface{}) *Error {
-	switch data.(type) {
+	switch data := data.(type) {
 	case string:
-		e.Payload = errors.New(data.(string))
+		e.Payload = errors.New(data)
 	case error:
-		e.Payload = data.(error)
+		e.Payload = data
 	case []string:
-		panic(data)
-		e.Payload = errors.New(data.([]string)[0])
+		errs := make(Errors, 0, len(data))
+		for _, msg := range data {
+			errs = append(errs, errors.New(msg))
+		}
+		e.Payload = errs
+	default:
+		e.Payload = fmt.Errorf("%v", data)
 	}
 	return e
 }
 
+// New returns a new *Error of the identifier. Every call returns an
+// independent value, so that wrapping it does not affect other errors.
 func (id Identifier) New() *Error {
-	return ErrorMap[id]
+	return &Error{
+		Identifier: id,
+	}
+}
+
+// Error makes an Identifier usable as a sentinel error, every *Error of
+// the identifier matches it with errors.Is.
+func (id Identifier) Error() string {
+	return string(id)
 }
@@ -0,0 +1,93 @@
+package empErr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	first := NotAllowEmptyEnvError.New().Wrap("miss environment key: FIRST")
+	second := NotAllowEmptyEnvError.New().Wrap("miss environment key: SECOND")
+
+	assert.NotSame(t, first, second)
+	assert.Contains(t, first.Error(), "FIRST")
+	assert.Contains(t, second.Error(), "SECOND")
+	assert.Nil(t, ErrorMap[NotAllowEmptyEnvError].Payload)
+
+	assert.True(t, errors.Is(first, NotAllowEmptyEnvError.New()))
+	assert.True(t, errors.Is(first, NotAllowEmptyEnvError))
+	assert.True(t, errors.Is(fmt.Errorf("parse: %w", first), NotAllowEmptyEnvError))
+	assert.False(t, errors.Is(first, CannotParseEnvStringToTypeError))
+	assert.False(t, errors.Is(first, (*Error)(nil)))
+}
+
+func TestWrap(t *testing.T) {
+	err := CannotParseEnvStringToTypeError.New().Wrap([]string{"first", "second"})
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+
+	assert.Len(t, errs, 2)
+	assert.Contains(t, err.Error(), "2 errors: first; second")
+
+	cause := errors.New("cause")
+	err = CannotParseEnvStringToTypeError.New().Wrap(cause)
+
+	assert.True(t, errors.Is(err, cause))
+
+	err = CannotParseEnvStringToTypeError.New().Wrap(42)
+
+	assert.Contains(t, err.Error(), "payload: 42")
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+
+	assert.Nil(t, errs.Err())
+
+	first := NotAllowEmptyEnvError.New().Wrap("first")
+	errs = errs.Append(first)
+
+	assert.Same(t, first, errs.Err())
+
+	errs = errs.Append(Errors{
+		CannotParseEnvStringToTypeError.New().Wrap("second"),
+		&FieldError{Key: "THIRD", Err: MissingIndexError.New()},
+	})
+
+	assert.Len(t, errs, 3)
+
+	err := errs.Err()
+
+	assert.True(t, errors.Is(err, NotAllowEmptyEnvError))
+	assert.True(t, errors.Is(err, MissingIndexError))
+	assert.False(t, errors.Is(err, DotenvSyntaxError))
+
+	var fieldErr *FieldError
+
+	assert.True(t, errors.As(err, &fieldErr))
+	assert.Equal(t, "THIRD", fieldErr.Key)
+}
+
+func TestConcurrentErrors(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make([]error, 100)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = NotAllowEmptyEnvError.New().Wrap(fmt.Sprintf("miss environment key: KEY_%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		assert.Equal(t, fmt.Sprintf("identifier: NotAllowEmptyEnvError, payload: miss environment key: KEY_%d", i), err.Error())
+		assert.True(t, errors.Is(err, NotAllowEmptyEnvError))
+	}
+}
@@ -0,0 +1,61 @@
+package empErr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors is a list of errors, e.g. one for every field that failed to
+// parse. errors.Is and errors.As look through all of them.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Errors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Append appends err to e, flattening err if it is Errors itself.
+func (e Errors) Append(err error) Errors {
+	if errs, ok := err.(Errors); ok {
+		return append(e, errs...)
+	}
+	return append(e, err)
+}
+
+// Err returns nil if e is empty, its only error if it has one, and e
+// otherwise.
+func (e Errors) Err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
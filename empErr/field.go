@@ -0,0 +1,44 @@
+package empErr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FieldError is the error of a struct field that failed to parse, use
+// errors.As to retrieve it:
+//
+//    var fieldErr *empErr.FieldError
+//    if errors.As(err, &fieldErr) {
+//        log.Printf("%s is invalid, set %s", fieldErr.Field, fieldErr.Key)
+//    }
+type FieldError struct {
+	// Key is the key the field is read from, e.g. LOG_ROTATE_MAXSIZE.
+	Key string
+	// Field is the path of the field in the Go struct, e.g.
+	// Config.Log.Rotate.MaxSize.
+	Field string
+	// Type is the type of the field.
+	Type reflect.Type
+	// Value is the raw value of the key, it is empty if Redacted is true.
+	Value string
+	// Redacted reports whether Value has been left out, because the field
+	// is tagged with "secret" or Config.RedactValues is set. The message
+	// of Err is then reduced to its identifier, Err still unwraps to the
+	// cause.
+	Redacted bool
+	// Err is the cause of the error.
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	value := fmt.Sprintf("%q", e.Value)
+	if e.Redacted {
+		value = "<redacted>"
+	}
+	return fmt.Sprintf("field %s (key %s, type %v, value %s): %s", e.Field, e.Key, e.Type, value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
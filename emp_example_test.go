@@ -44,7 +44,7 @@ func TestReadmeExample2(t *testing.T) {
 			PORT         string
 			HTTP_TIMEOUT int
 		}
-		// whatever type you want, but not map
+		// whatever type you want
 	}
 
 	res, err := Marshal(&EnvModel{})
@@ -76,7 +76,7 @@ func TestReadmeExample2(t *testing.T) {
 			Port        string `emp:"SERVER_PORT"`
 			HttpTimeout int    `emp:"SERVER_HTTP_TIMEOUT"`
 		} `emp:"prefix:SERVER_"`
-		// whatever type you want, but not map
+		// whatever type you want
 	}
 
 	res, err = Marshal(&EnvModel1{})
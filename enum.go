@@ -0,0 +1,86 @@
+package emp
+
+import (
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"reflect"
+	"strings"
+)
+
+// Enum is implemented by types that only accept a fixed set of values, e.g.
+// a named string type of log levels. Fields of such types are checked as if
+// they were tagged with "oneof".
+type Enum interface {
+	EnumValues() []string
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+// allowedValues returns the values a field of type valType tagged with opts
+// may hold, or nil if it may hold any value. The element type of pointers,
+// slices, arrays and maps is used, as the check applies to their elements.
+func allowedValues(opts tagOptions, valType reflect.Type) []string {
+	if oneof, ok := opts["oneof"]; ok {
+		return strings.Split(oneof, "|")
+	}
+
+	for {
+		switch valType.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			valType = valType.Elem()
+			continue
+		}
+		break
+	}
+
+	if valType.Kind() == reflect.Interface {
+		return nil
+	}
+	if valType.Implements(enumType) {
+		return reflect.Zero(valType).Interface().(Enum).EnumValues()
+	}
+	if reflect.PtrTo(valType).Implements(enumType) {
+		return reflect.New(valType).Interface().(Enum).EnumValues()
+	}
+	return nil
+}
+
+// isEnumKind reports whether values of kind are checked against their
+// allowed values, the others are containers checked element by element.
+func isEnumKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// checkEnum returns a NotAllowedValueError if val, which has been parsed
+// from key, is not one of allowed. With the "ignorecase" tag option, values
+// are compared case-insensitively, and string values are set to the
+// spelling of allowed.
+func (p *Parser) checkEnum(key string, opts tagOptions, allowed []string, val reflect.Value) error {
+	value, err := p.formatValue(opts, val)
+	if err != nil {
+		return err
+	}
+
+	_, ignoreCase := opts["ignorecase"]
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+		if ignoreCase && strings.EqualFold(value, a) {
+			if val.Kind() == reflect.String {
+				val.SetString(a)
+			}
+			return nil
+		}
+	}
+
+	msg := fmt.Sprintf("%q is not one of %s", value, strings.Join(allowed, ", "))
+	if key != "" {
+		msg = key + ": " + msg
+	}
+	return empErr.NotAllowedValueError.New().Wrap(msg)
+}
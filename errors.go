@@ -0,0 +1,86 @@
+package emp
+
+import (
+	"errors"
+	"github.com/XMLHexagram/emp/empErr"
+	"reflect"
+	"strings"
+)
+
+// wrapFieldError turns err, returned while parsing the field of type
+// valType read from key, into an *empErr.FieldError. The errors of nested
+// fields already are FieldErrors, field is then added in front of their
+// path, as every level of the struct does until the path is complete.
+func (p *Parser) wrapFieldError(err error, field string, key string, default_ string, opts tagOptions, valType reflect.Type) error {
+	switch e := err.(type) {
+	case *empErr.FieldError:
+		prependField(e, field)
+		return e
+	case empErr.Errors:
+		res := make(empErr.Errors, 0, len(e))
+		for _, err := range e {
+			res = append(res, p.wrapFieldError(err, field, key, default_, opts, valType))
+		}
+		return res
+	}
+
+	fieldErr := &empErr.FieldError{
+		Key:   key,
+		Field: field,
+		Type:  valType,
+		Err:   err,
+	}
+
+	value, ok := p.lookup(key)
+	if !ok {
+		value = default_
+	}
+
+	if _, secret := opts["secret"]; secret || p.config.RedactValues {
+		fieldErr.Redacted = true
+		if value != "" {
+			fieldErr.Err = &redactedError{err: err}
+		}
+	} else {
+		fieldErr.Value = value
+	}
+	return fieldErr
+}
+
+// redactedError hides the message of err, which usually quotes the value
+// that failed to parse. Only the identifier of err is kept.
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	var empError *empErr.Error
+	if errors.As(e.err, &empError) {
+		return empError.Identifier.New().Wrap("message redacted").Error()
+	}
+	return "message redacted"
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// prependField adds parent in front of the path of the FieldErrors in err.
+// Parents written as indexes, e.g. "[0]", are joined without a dot.
+func prependField(err error, parent string) {
+	switch e := err.(type) {
+	case *empErr.FieldError:
+		switch {
+		case e.Field == "":
+			e.Field = parent
+		case strings.HasPrefix(e.Field, "["):
+			e.Field = parent + e.Field
+		default:
+			e.Field = parent + "." + e.Field
+		}
+	case empErr.Errors:
+		for _, err := range e {
+			prependField(err, parent)
+		}
+	}
+}
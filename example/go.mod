@@ -4,7 +4,6 @@ go 1.17
 
 require (
 	github.com/XMLHexagram/emp v1.0.0-beta.2
-	github.com/joho/godotenv v1.4.0
 	github.com/stretchr/testify v1.7.0
 )
 
@@ -13,3 +12,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
+
+replace github.com/XMLHexagram/emp => ../
@@ -3,15 +3,9 @@ package main
 import (
 	"fmt"
 	"github.com/XMLHexagram/emp"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	err := godotenv.Load()
-	if err != nil {
-		panic(err)
-	}
-
 	//res, err := emp.Marshal(&Config{})
 	//if err != nil {
 	//	panic(err)
@@ -31,7 +25,16 @@ func main() {
 func ParserEnv() (*Config, error) {
 	config := new(Config)
 
-	err := emp.Parse(config)
+	// reads .env, .env.$APP_ENV, .env.local and .env.$APP_ENV.local,
+	// environment variables of the process take precedence over them
+	parser, err := emp.NewParser(&emp.Config{
+		ProfileSelector: "APP_ENV",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = parser.Parse(config)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,12 @@
 package main
 
 type Config struct {
-	Server `emp:"prefix:SERVER_"`
-	Db     `emp:"prefix:DB_"`
-	Cache  `emp:"prefix:CACHE_"`
-	Log    `emp:"prefix:LOG_"`
+	Server   `emp:"prefix:SERVER_"`
+	Db       `emp:"prefix:DB_"`
+	DbMap    `emp:"DB"`
+	Cache    `emp:"prefix:CACHE_"`
+	CacheMap `emp:"CACHE"`
+	Log      `emp:"prefix:LOG_"`
 }
 
 type Http struct {
@@ -21,14 +23,16 @@ type Db struct {
 	DSN    string `emp:"DSN"`
 }
 
-//type DbMap map[string]Db
+// DbMap holds named databases, e.g. DB_REPLICA_DSN for the DSN of REPLICA.
+type DbMap map[string]Db
 
 type Cache struct {
 	Driver string `emp:"DRIVER"`
 	DSN    string `emp:"DSN"`
 }
 
-//type CacheMap map[string]Cache
+// CacheMap holds named caches, e.g. CACHE_SESSION_DSN for the DSN of SESSION.
+type CacheMap map[string]Cache
 
 type Log struct {
 	Level       string `emp:"LEVEL"`
@@ -0,0 +1,193 @@
+package emp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"reflect"
+)
+
+// DecodeHookFunc converts a value to the type it is registered for in
+// Config.DecodeHooks. The returned value must be assignable to that type,
+// or convertible to it without changing kind, except that []byte and
+// string convert to each other and a slice converts to an array of the
+// same length.
+type DecodeHookFunc func(value string) (interface{}, error)
+
+// EncodeHookFunc formats a value of the type it is registered for in
+// Config.EncodeHooks, it is the counterpart of DecodeHookFunc used by
+// Marshal.
+type EncodeHookFunc func(value interface{}) (string, error)
+
+// namedParser is a parser registered by Parser.RegisterParser.
+type namedParser struct {
+	decode DecodeHookFunc
+	encode EncodeHookFunc
+}
+
+// builtinParsers are the parsers every Parser starts with.
+var builtinParsers = map[string]namedParser{
+	"base64": {
+		decode: func(value string) (interface{}, error) {
+			return base64.StdEncoding.DecodeString(value)
+		},
+		encode: func(value interface{}) (string, error) {
+			return base64.StdEncoding.EncodeToString(bytesOf(value)), nil
+		},
+	},
+	"hex": {
+		decode: func(value string) (interface{}, error) {
+			return hex.DecodeString(value)
+		},
+		encode: func(value interface{}) (string, error) {
+			return hex.EncodeToString(bytesOf(value)), nil
+		},
+	},
+}
+
+// bytesOf returns the bytes of a []byte, a byte array or a string.
+func bytesOf(value interface{}) []byte {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String())
+	case reflect.Array:
+		res := make([]byte, v.Len())
+		for i := range res {
+			res[i] = byte(v.Index(i).Uint())
+		}
+		return res
+	}
+	return v.Bytes()
+}
+
+// RegisterParser registers a parser that fields tagged with
+// "parser:<name>" are parsed with, e.g. `emp:"KEY,parser:base64"`. This lets
+// the same Go type be parsed from different formats in different fields.
+// encode is used by Marshal and may be nil, in which case the field is
+// marshalled as usual.
+//
+// The parsers "base64" and "hex" are built in, they decode to []byte,
+// byte array or string fields.
+//
+// RegisterParser must be called before the Parser is used.
+func (p *Parser) RegisterParser(name string, decode DecodeHookFunc, encode EncodeHookFunc) {
+	p.parsers[name] = namedParser{
+		decode: decode,
+		encode: encode,
+	}
+}
+
+// parseNamed parses val with the parser selected by the "parser" tag
+// option. It reports whether val has been handled.
+func (p *Parser) parseNamed(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) (bool, error) {
+	parserName, ok := opts["parser"]
+	if !ok {
+		return false, nil
+	}
+
+	parser, ok := p.parsers[parserName]
+	if !ok {
+		return true, empErr.InvalidConfigError.New().Wrap("unknown parser: " + parserName)
+	}
+
+	if p.marshal && parser.encode == nil {
+		return false, nil
+	}
+
+	return true, p.decodeWith(parser.decode, parser.encode, prefix+name, default_, directDefault, val)
+}
+
+// isHookType reports whether a decode hook is registered for valType.
+func (p *Parser) isHookType(valType reflect.Type) bool {
+	_, ok := p.config.DecodeHooks[valType]
+	return ok
+}
+
+// parseHook parses val with the hook registered for its type, and with
+// the encode hook when marshalling. It reports whether val has been
+// handled.
+func (p *Parser) parseHook(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) (bool, error) {
+	valType := val.Type()
+
+	if p.marshal {
+		encode, ok := p.config.EncodeHooks[valType]
+		if !ok {
+			return false, nil
+		}
+		return true, p.decodeWith(nil, encode, prefix+name, default_, directDefault, val)
+	}
+
+	decode, ok := p.config.DecodeHooks[valType]
+	if !ok {
+		return false, nil
+	}
+	return true, p.decodeWith(decode, nil, prefix+name, default_, directDefault, val)
+}
+
+// decodeWith parses val with decode, or marshals it with encode when
+// marshalling.
+func (p *Parser) decodeWith(decode DecodeHookFunc, encode EncodeHookFunc, key string, default_ string, directDefault bool, val reflect.Value) error {
+	valType := val.Type()
+
+	if p.marshal {
+		value, err := encode(val.Interface())
+		if err != nil {
+			return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+		}
+		p.marshalEnv(key, value)
+		return nil
+	}
+
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := decode(envString)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	res, err := convertHookValue(reflect.ValueOf(value), valType)
+	if err != nil {
+		return err
+	}
+
+	val.Set(res)
+	return nil
+}
+
+// convertHookValue converts res, returned by a DecodeHookFunc, to valType.
+// Besides assignable values, it converts between types of the same kind,
+// between []byte and string, and from a slice to an array of the same
+// length.
+func convertHookValue(res reflect.Value, valType reflect.Type) (reflect.Value, error) {
+	if !res.IsValid() {
+		return res, empErr.InvalidConfigError.New().Wrap(fmt.Sprintf("parser of %s returned nil", valType))
+	}
+
+	resType := res.Type()
+	switch {
+	case resType.AssignableTo(valType):
+		return res, nil
+	case resType.Kind() == valType.Kind() && resType.ConvertibleTo(valType):
+		return res.Convert(valType), nil
+	case isBytesOrString(resType) && isBytesOrString(valType) && resType.ConvertibleTo(valType):
+		return res.Convert(valType), nil
+	case resType.Kind() == reflect.Slice && valType.Kind() == reflect.Array && resType.Elem() == valType.Elem():
+		if res.Len() != valType.Len() {
+			return res, empErr.CannotParseEnvStringToTypeError.New().Wrap(fmt.Sprintf("got %d elements for %s", res.Len(), valType))
+		}
+		arr := reflect.New(valType).Elem()
+		reflect.Copy(arr, res)
+		return arr, nil
+	}
+	return res, empErr.InvalidConfigError.New().Wrap(fmt.Sprintf("parser of %s returned %s", valType, resType))
+}
+
+// isBytesOrString reports whether t is a string or a []byte.
+func isBytesOrString(t reflect.Type) bool {
+	return t.Kind() == reflect.String || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+}
@@ -0,0 +1,45 @@
+package emp
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/XMLHexagram/emp/empErr"
+	"reflect"
+)
+
+// parseJSON parses a field tagged with "json" by decoding its value with
+// encoding/json, so it can be of any type, e.g. `emp:"FEATURE_MATRIX,json"`.
+func (p *Parser) parseJSON(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	key := prefix + name
+
+	if p.marshal {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		err := encoder.Encode(val.Interface())
+		if err != nil {
+			return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+		}
+		p.marshalEnv(key, string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))))
+		return nil
+	}
+
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	// decode into a copy, so that val is left untouched on error
+	res := reflect.New(val.Type())
+	if !p.config.ZeroFields {
+		res.Elem().Set(val)
+	}
+
+	err = json.Unmarshal([]byte(envString), res.Interface())
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.Set(res.Elem())
+	return nil
+}
@@ -0,0 +1,104 @@
+package emp
+
+import (
+	"encoding"
+	"github.com/XMLHexagram/emp/empErr"
+	"reflect"
+)
+
+// Unmarshaler is the interface implemented by types that can parse
+// themselves from a value. UnmarshalEnv receives the key the value was
+// looked up with, which is empty for the elements of slices and maps.
+//
+// Types implementing Unmarshaler take precedence over
+// encoding.TextUnmarshaler.
+type Unmarshaler interface {
+	UnmarshalEnv(key string, value string) error
+}
+
+// Marshaler is the interface implemented by types that can format
+// themselves as a value, it is the counterpart of Unmarshaler used by
+// Marshal.
+//
+// Types implementing Marshaler take precedence over encoding.TextMarshaler.
+type Marshaler interface {
+	MarshalEnv(key string) (string, error)
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isUnmarshalerType reports whether pointers to valType implement
+// Unmarshaler or encoding.TextUnmarshaler.
+func isUnmarshalerType(valType reflect.Type) bool {
+	ptrType := reflect.PtrTo(valType)
+	return ptrType.Implements(unmarshalerType) || ptrType.Implements(textUnmarshalerType)
+}
+
+// parseUnmarshaler parses val with its own UnmarshalEnv or UnmarshalText
+// method, and with MarshalEnv or MarshalText when marshalling. It reports
+// whether val has been handled.
+func (p *Parser) parseUnmarshaler(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) (bool, error) {
+	if val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		return false, nil
+	}
+
+	key := prefix + name
+
+	if p.marshal {
+		candidates := []interface{}{val.Interface()}
+		if val.CanAddr() {
+			candidates = append(candidates, val.Addr().Interface())
+		}
+		for _, candidate := range candidates {
+			switch marshaler := candidate.(type) {
+			case Marshaler:
+				value, err := marshaler.MarshalEnv(key)
+				if err != nil {
+					return true, empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+				}
+				p.marshalEnv(key, value)
+				return true, nil
+			case encoding.TextMarshaler:
+				value, err := marshaler.MarshalText()
+				if err != nil {
+					return true, empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+				}
+				p.marshalEnv(key, string(value))
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if !val.CanAddr() {
+		return false, nil
+	}
+
+	var unmarshal func(envString string) error
+	switch unmarshaler := val.Addr().Interface().(type) {
+	case Unmarshaler:
+		unmarshal = func(envString string) error {
+			return unmarshaler.UnmarshalEnv(key, envString)
+		}
+	case encoding.TextUnmarshaler:
+		unmarshal = func(envString string) error {
+			return unmarshaler.UnmarshalText([]byte(envString))
+		}
+	default:
+		return false, nil
+	}
+
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return true, err
+	}
+
+	err = unmarshal(envString)
+	if err != nil {
+		return true, empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+//go:build go1.18
+// +build go1.18
+
+package emp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+)
+
+func TestNetip(t *testing.T) {
+	type args struct {
+		Addr     netip.Addr       `emp:"ADDR"`
+		Prefixes []netip.Prefix   `emp:"PREFIXES"`
+		Listen   netip.AddrPort   `emp:"LISTEN"`
+		Peers    []netip.AddrPort `emp:"PEERS"`
+	}
+
+	source := MapSource{
+		"ADDR":     "fd00::1",
+		"PREFIXES": "10.0.0.0/8,fd00::/8",
+		"LISTEN":   "0.0.0.0:8080",
+		"PEERS":    "10.0.0.1:7946,[::1]:7946",
+	}
+
+	expect := &args{
+		Addr:     netip.MustParseAddr("fd00::1"),
+		Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")},
+		Listen:   netip.MustParseAddrPort("0.0.0.0:8080"),
+		Peers:    []netip.AddrPort{netip.MustParseAddrPort("10.0.0.1:7946"), netip.MustParseAddrPort("[::1]:7946")},
+	}
+
+	res := new(args)
+
+	parser, err := NewParser(&Config{
+		Source: source,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expect, res)
+
+	out, err := parser.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, `ADDR=fd00::1
+PREFIXES=10.0.0.0/8,fd00::/8
+LISTEN=0.0.0.0:8080
+PEERS=10.0.0.1:7946,[::1]:7946
+`, out)
+}
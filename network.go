@@ -0,0 +1,88 @@
+package emp
+
+import (
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var ipNetType = reflect.TypeOf(net.IPNet{})
+
+// parseHostPort validates a host:port address, defaultPort is used when s
+// has no port. The address is returned in the form of net.JoinHostPort.
+func parseHostPort(s string, defaultPort string) (string, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil && defaultPort != "" {
+		host = s
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+		host, port, err = net.SplitHostPort(net.JoinHostPort(host, defaultPort))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid port %q of address %q", port, s)
+	}
+
+	return net.JoinHostPort(host, strconv.FormatUint(n, 10)), nil
+}
+
+func (p *Parser) parseIPNet(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+
+	if p.marshal {
+		ipNet := val.Interface().(net.IPNet)
+		if ipNet.IP == nil {
+			p.marshalEnv(prefix+name, "")
+		} else {
+			p.marshalEnv(prefix+name, ipNet.String())
+		}
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	_, value, err := net.ParseCIDR(envString)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.Set(reflect.ValueOf(*value))
+	return nil
+}
+
+// parseHostPort parses a string field tagged with "hostport", the tag
+// option may hold a default port, e.g. `emp:"LISTEN,hostport:8080"`.
+func (p *Parser) parseHostPort(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+
+	if p.marshal {
+		p.marshalEnv(prefix+name, val.String())
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseHostPort(envString, opts["hostport"])
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.SetString(value)
+	return nil
+}
@@ -0,0 +1,54 @@
+package emp
+
+import (
+	"reflect"
+)
+
+// optional is implemented by *Optional[T]. It is declared apart from
+// Optional, so that emp still builds with Go versions before 1.21, which
+// cannot compile generics in a module that declares go 1.17.
+type optional interface {
+	optionalValue() reflect.Value
+	isPresent() bool
+	setPresent(present bool)
+}
+
+var optionalType = reflect.TypeOf((*optional)(nil)).Elem()
+
+// isOptionalType reports whether valType is an instance of Optional.
+func isOptionalType(valType reflect.Type) bool {
+	return reflect.PtrTo(valType).Implements(optionalType)
+}
+
+// parseOptional parses an Optional field, recording whether its key is
+// present in the Source. A missing key is not an error, the value is left
+// as is unless the field has a default value.
+func (p *Parser) parseOptional(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	o := val.Addr().Interface().(optional)
+
+	if p.marshal {
+		if !o.isPresent() {
+			return nil
+		}
+		return p.parse(prefix, name, default_, directDefault, opts, o.optionalValue())
+	}
+
+	present := false
+	if !directDefault {
+		_, present = p.lookup(prefix + name)
+	}
+
+	if p.config.ZeroFields {
+		val.Set(reflect.Zero(val.Type()))
+	}
+
+	if present || default_ != "" {
+		err := p.parse(prefix, name, default_, directDefault, opts, o.optionalValue())
+		if err != nil {
+			return err
+		}
+	}
+
+	o.setPresent(present)
+	return nil
+}
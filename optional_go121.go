@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package emp
+
+import (
+	"reflect"
+)
+
+// Optional holds the value of a key along with whether the key is present
+// in the Source, which tells an unset key apart from one set to the zero
+// value. Under EmptyUsesDefault, a key set to an empty value counts as
+// unset. Marshal skips Optional fields that are not present.
+//
+//    type Model struct {
+//        MAX_CONNS emp.Optional[int]
+//    }
+//
+// Optional requires Go 1.21 or later.
+type Optional[T any] struct {
+	Value   T
+	Present bool
+}
+
+// Get returns the value and whether its key is present.
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Present
+}
+
+func (o *Optional[T]) optionalValue() reflect.Value {
+	return reflect.ValueOf(&o.Value).Elem()
+}
+
+func (o *Optional[T]) isPresent() bool {
+	return o.Present
+}
+
+func (o *Optional[T]) setPresent(present bool) {
+	o.Present = present
+}
@@ -0,0 +1,88 @@
+//go:build go1.21
+// +build go1.21
+
+package emp
+
+import (
+	"errors"
+	"github.com/XMLHexagram/emp/empErr"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	type args struct {
+		MaxConns Optional[int]            `emp:"MAX_CONNS"`
+		Timeout  Optional[int]            `emp:"TIMEOUT,default:30"`
+		Missing  Optional[string]         `emp:"MISSING"`
+		Empty    Optional[string]         `emp:"EMPTY"`
+		Levels   Optional[[]string]       `emp:"LEVELS"`
+		Limits   Optional[map[string]int] `emp:"LIMITS,json"`
+	}
+
+	source := MapSource{
+		"MAX_CONNS": "0",
+		"EMPTY":     "",
+		"LEVELS":    "info,warn",
+		"LIMITS":    `{"burst":10}`,
+	}
+
+	parser, err := NewParser(&Config{
+		Source: source,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := new(args)
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &args{
+		MaxConns: Optional[int]{Value: 0, Present: true},
+		Timeout:  Optional[int]{Value: 30, Present: false},
+		Levels:   Optional[[]string]{Value: []string{"info", "warn"}, Present: true},
+		Limits:   Optional[map[string]int]{Value: map[string]int{"burst": 10}, Present: true},
+	}, res)
+
+	value, ok := res.MaxConns.Get()
+
+	assert.Equal(t, 0, value)
+	assert.True(t, ok)
+
+	out, err := parser.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "MAX_CONNS=0\nLEVELS=info,warn\nLIMITS='{\"burst\":10}'\n", out)
+
+	parser, err = NewParser(&Config{
+		Source:      source,
+		EmptyPolicy: EmptyIsSet,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = new(args)
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, Optional[string]{Value: "", Present: true}, res.Empty)
+
+	parser, err = NewParser(&Config{
+		Source:      source,
+		EmptyPolicy: EmptyIsError,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(new(args))
+
+	assert.True(t, errors.Is(err, empErr.NotAllowEmptyEnvError.New()))
+}
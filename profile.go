@@ -0,0 +1,52 @@
+package emp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// profileFiles returns the env files of profile, in the order they are
+// read, each one overriding the previous:
+//
+//     .env
+//     .env.<profile>
+//     .env.local
+//     .env.<profile>.local
+func profileFiles(profile string) []string {
+	if profile == "" {
+		return []string{".env", ".env.local"}
+	}
+	return []string{".env", ".env." + profile, ".env.local", ".env." + profile + ".local"}
+}
+
+// readProfile reads the env files of profile in dir. Files that do not
+// exist are skipped, the files that were read are returned. A profile with
+// path separators is rejected, as it would read files outside of dir.
+func readProfile(dir string, profile string) ([]string, MapSource, error) {
+	if strings.ContainsAny(profile, `/\`) || strings.ContainsRune(profile, os.PathSeparator) {
+		return nil, nil, empErr.InvalidConfigError.New().Wrap(fmt.Sprintf("invalid profile %q: must not contain path separators", profile))
+	}
+
+	files := make([]string, 0)
+	for _, name := range profileFiles(profile) {
+		filename := filepath.Join(dir, name)
+		_, err := os.Stat(filename)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, filename)
+	}
+
+	source, err := ReadDotenv(files...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, source, nil
+}
@@ -0,0 +1,155 @@
+package emp
+
+import (
+	"errors"
+	"github.com/XMLHexagram/emp/empErr"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeEnvFiles(t *testing.T, files map[string]string) string {
+	dir := tempDir(t)
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestProfile(t *testing.T) {
+	dir := writeEnvFiles(t, map[string]string{
+		".env":                  "BASE=base\nPROFILE=base\nLOCAL=base\nPROFILE_LOCAL=base\nENV=base\n",
+		".env.production":       "PROFILE=production\nLOCAL=production\nPROFILE_LOCAL=production\n",
+		".env.local":            "LOCAL=local\nPROFILE_LOCAL=local\n",
+		".env.production.local": "PROFILE_LOCAL=production.local\n",
+		".env.staging":          "PROFILE=staging\n",
+	})
+
+	type args struct {
+		BASE          string
+		PROFILE       string
+		LOCAL         string
+		PROFILE_LOCAL string
+		ENV           string
+	}
+
+	expect := &args{
+		BASE:          "base",
+		PROFILE:       "production",
+		LOCAL:         "local",
+		PROFILE_LOCAL: "production.local",
+		ENV:           "env",
+	}
+
+	res := new(args)
+
+	parser, err := NewParser(&Config{
+		Source: MapSource{
+			"APP_ENV": "production",
+			"ENV":     "env",
+		},
+		ProfileSelector: "APP_ENV",
+		ProfileDir:      dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, expect, res)
+	assert.Equal(t, "production", parser.Profile())
+	assert.Equal(t, []string{
+		filepath.Join(dir, ".env"),
+		filepath.Join(dir, ".env.production"),
+		filepath.Join(dir, ".env.local"),
+		filepath.Join(dir, ".env.production.local"),
+	}, parser.ProfileFiles())
+}
+
+func TestDefaultProfile(t *testing.T) {
+	dir := writeEnvFiles(t, map[string]string{
+		".env":         "PROFILE=base\n",
+		".env.staging": "PROFILE=staging\n",
+	})
+
+	type args struct {
+		PROFILE string
+	}
+
+	res := new(args)
+
+	parser, err := NewParser(&Config{
+		Source:          MapSource{},
+		ProfileSelector: "APP_ENV",
+		DefaultProfile:  "staging",
+		ProfileDir:      dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = parser.Parse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, &args{PROFILE: "staging"}, res)
+	assert.Equal(t, "staging", parser.Profile())
+	assert.Equal(t, []string{
+		filepath.Join(dir, ".env"),
+		filepath.Join(dir, ".env.staging"),
+	}, parser.ProfileFiles())
+}
+
+func TestProfilePrecedence(t *testing.T) {
+	dir := writeEnvFiles(t, map[string]string{
+		".env": "K=file\nFILE=file\n",
+	})
+
+	type args struct {
+		K    string
+		FILE string
+	}
+
+	for _, precedence := range []Precedence{LastLayerWins, FirstLayerWins} {
+		res := new(args)
+
+		parser, err := NewParser(&Config{
+			Layers:          []Source{MapSource{"K": "cli"}},
+			Precedence:      precedence,
+			ProfileSelector: "APP_ENV",
+			ProfileDir:      dir,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = parser.Parse(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, &args{K: "cli", FILE: "file"}, res, precedence)
+	}
+}
+
+func TestProfileWithPathSeparator(t *testing.T) {
+	dir := writeEnvFiles(t, map[string]string{
+		".env": "PROFILE=base\n",
+	})
+
+	for _, profile := range []string{"../secrets", "prod/../../etc", `..\secrets`} {
+		_, err := NewParser(&Config{
+			Source:          MapSource{"APP_ENV": profile},
+			ProfileSelector: "APP_ENV",
+			ProfileDir:      dir,
+		})
+
+		assert.True(t, errors.Is(err, empErr.InvalidConfigError), profile)
+	}
+}
@@ -0,0 +1,144 @@
+package emp
+
+import (
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// defaultTypeKey is the key, under the prefix of an interface field, that
+// selects the type registered by Parser.RegisterType.
+const defaultTypeKey = "TYPE"
+
+// RegisterType registers impl as the implementation of the interface iface
+// points to, selected when the discriminator key of a field of that
+// interface holds name, which is matched case-insensitively:
+//
+//    type StorageBackend interface{ Open() error }
+//
+//    type S3 struct {
+//        BUCKET string
+//        REGION string
+//    }
+//
+//    err := parser.RegisterType((*StorageBackend)(nil), "s3", &S3{})
+//
+// A StorageBackend field tagged `emp:"STORAGE"` is then filled with an *S3
+// when STORAGE_TYPE=s3, its fields being parsed under the STORAGE_ prefix,
+// e.g. STORAGE_BUCKET. The "type" tag option changes the name of
+// the discriminator key, `emp:"STORAGE,type:KIND"` reads STORAGE_KIND.
+//
+// impl must be a struct or a pointer to a struct implementing the
+// interface. RegisterType must be called before the Parser is used.
+func (p *Parser) RegisterType(iface interface{}, name string, impl interface{}) error {
+	ifaceType := reflect.TypeOf(iface)
+	if ifaceType == nil || ifaceType.Kind() != reflect.Ptr || ifaceType.Elem().Kind() != reflect.Interface {
+		return empErr.InvalidConfigError.New().Wrap(fmt.Sprintf("RegisterType expects a pointer to an interface, got %v", ifaceType))
+	}
+	ifaceType = ifaceType.Elem()
+
+	implType := reflect.TypeOf(impl)
+	if implType == nil || structOf(implType).Kind() != reflect.Struct {
+		return empErr.InvalidConfigError.New().Wrap(fmt.Sprintf("RegisterType expects a struct or a pointer to a struct, got %v", implType))
+	}
+	if !implType.Implements(ifaceType) {
+		return empErr.InvalidConfigError.New().Wrap(fmt.Sprintf("%v does not implement %v", implType, ifaceType))
+	}
+
+	if p.types[ifaceType] == nil {
+		p.types[ifaceType] = make(map[string]reflect.Type)
+	}
+	p.types[ifaceType][name] = implType
+	return nil
+}
+
+// structOf returns the element type of t if it is a pointer, t otherwise.
+func structOf(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+// lookupType returns the type registered for the interface ifaceType under
+// a name equal to name, ignoring case.
+func (p *Parser) lookupType(ifaceType reflect.Type, name string) (reflect.Type, bool) {
+	for registered, implType := range p.types[ifaceType] {
+		if strings.EqualFold(registered, name) {
+			return implType, true
+		}
+	}
+	return nil, false
+}
+
+// typeNames returns the sorted names registered for the interface ifaceType.
+func (p *Parser) typeNames(ifaceType reflect.Type) []string {
+	res := make([]string, 0, len(p.types[ifaceType]))
+	for name := range p.types[ifaceType] {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// parseRegistered parses an interface field whose type has implementations
+// registered by Parser.RegisterType.
+func (p *Parser) parseRegistered(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	ifaceType := val.Type()
+	entryPrefix := mapEntryPrefix(prefix + name)
+	typeKey := defaultTypeKey
+	if opts["type"] != "" {
+		typeKey = opts["type"]
+	}
+
+	if p.marshal {
+		if val.IsNil() {
+			p.marshalEnv(entryPrefix+typeKey, "")
+			return nil
+		}
+
+		current := val.Elem()
+		for _, typeName := range p.typeNames(ifaceType) {
+			if p.types[ifaceType][typeName] != current.Type() {
+				continue
+			}
+			p.marshalEnv(entryPrefix+typeKey, typeName)
+
+			// copy the value, so that its fields are settable
+			inst := reflect.New(structOf(current.Type()))
+			if current.Kind() != reflect.Ptr || !current.IsNil() {
+				inst.Elem().Set(reflect.Indirect(current))
+			}
+			return p.parse(entryPrefix, "", "", directDefault, tagOptions{}, inst.Elem())
+		}
+		return empErr.UnsupportedTypeError.New().Wrap(fmt.Sprintf("%v is not registered for %v", current.Type(), ifaceType))
+	}
+
+	typeName, err := p.getEnvString(entryPrefix+typeKey, default_, directDefault)
+	if err != nil {
+		return err
+	}
+	if typeName == "" {
+		return nil
+	}
+
+	implType, ok := p.lookupType(ifaceType, typeName)
+	if !ok {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(fmt.Sprintf("%s: unknown type %q, registered: %s", entryPrefix+typeKey, typeName, strings.Join(p.typeNames(ifaceType), ", ")))
+	}
+
+	inst := reflect.New(structOf(implType))
+	err = p.parse(entryPrefix, "", "", directDefault, tagOptions{}, inst.Elem())
+	if err != nil {
+		return err
+	}
+
+	if implType.Kind() == reflect.Ptr {
+		val.Set(inst)
+	} else {
+		val.Set(inst.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package emp
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// A Source provides the raw values that a Parser fills into a struct.
+//
+// Lookup returns the value stored under key, and reports whether the key
+// is present in the Source at all.
+type Source interface {
+	Lookup(key string) (value string, ok bool)
+}
+
+// A Lister is a Source that can enumerate its keys. Map fields are filled
+// by looking for keys under the prefix of the field, so they need a Source
+// that implements Lister.
+type Lister interface {
+	Keys() []string
+}
+
+// OSSource is a Source backed by the environment of the current process.
+// It is the default Source of Config.
+type OSSource struct{}
+
+// Lookup retrieves the value of the environment variable named by the key.
+func (OSSource) Lookup(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+// Keys returns the names of all environment variables of the process.
+func (OSSource) Keys() []string {
+	environ := os.Environ()
+	res := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		// skip the special "=C:=C:\" variables on Windows
+		if i <= 0 {
+			continue
+		}
+		res = append(res, kv[:i])
+	}
+	sort.Strings(res)
+	return res
+}
+
+// MapSource is a Source backed by an in-memory map. It is handy for tests
+// and for values read from files or secret stores.
+type MapSource map[string]string
+
+// Lookup retrieves the value stored in the map under the key.
+func (m MapSource) Lookup(key string) (string, bool) {
+	value, ok := m[key]
+	return value, ok
+}
+
+// Keys returns the keys of the map.
+func (m MapSource) Keys() []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ChainSource is a Source that asks each of its sources in order, the first
+// source that has the key wins.
+type ChainSource []Source
+
+// Lookup retrieves the value from the first source that has the key.
+func (c ChainSource) Lookup(key string) (string, bool) {
+	for _, source := range c {
+		if source == nil {
+			continue
+		}
+		if value, ok := source.Lookup(key); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Keys returns the keys of all sources that implement Lister.
+func (c ChainSource) Keys() []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, source := range c {
+		lister, ok := source.(Lister)
+		if !ok {
+			continue
+		}
+		for _, k := range lister.Keys() {
+			if !seen[k] {
+				seen[k] = true
+				res = append(res, k)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Precedence decides which layer wins when more than one of Config.Layers
+// has the same key.
+type Precedence int
+
+const (
+	// LastLayerWins resolves a key with the last layer that has it, so later
+	// layers override earlier ones.
+	LastLayerWins Precedence = iota
+	// FirstLayerWins resolves a key with the first layer that has it, it
+	// flips the order of Config.Layers, e.g. to let files override the
+	// process environment during local development.
+	FirstLayerWins
+)
+
+// stackLayers turns layers into a single Source, asking the layer with the
+// highest precedence first.
+func stackLayers(layers []Source, precedence Precedence) Source {
+	res := make(ChainSource, 0, len(layers))
+	if precedence == FirstLayerWins {
+		return append(res, layers...)
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		res = append(res, layers[i])
+	}
+	return res
+}
+
+// EmptyPolicy decides how a key that is present in the Source, but set to
+// an empty value like FOO=, is treated.
+type EmptyPolicy int
+
+const (
+	// EmptyUsesDefault treats an empty value as if the key was unset, so the
+	// default value of the field is used.
+	EmptyUsesDefault EmptyPolicy = iota
+	// EmptyIsSet treats an empty value as a value, the default value of the
+	// field is ignored, and fields that can not be parsed from an empty
+	// string fail.
+	EmptyIsSet
+	// EmptyIsError fails with a NotAllowEmptyEnvError when a key is set to an
+	// empty value.
+	EmptyIsError
+)
@@ -0,0 +1,110 @@
+package emp
+
+import (
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// parseDuration parses a duration such as "30s" or "1h30m", a plain
+// integer is a number of seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if seconds > math.MaxInt64/int64(time.Second) || seconds < math.MinInt64/int64(time.Second) {
+			return 0, fmt.Errorf("duration of %d seconds is out of range", seconds)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// parseTime parses s with layout, which is either a layout of the time
+// package, "unix" or "unixmilli" for the number of seconds or milliseconds
+// since the Unix epoch. The empty layout is time.RFC3339.
+func parseTime(s string, layout string) (time.Time, error) {
+	switch strings.ToLower(layout) {
+	case "", "rfc3339":
+		return time.Parse(time.RFC3339, s)
+	case "unix":
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	case "unixmilli":
+		msec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(msec/1e3, (msec%1e3)*1e6).UTC(), nil
+	}
+	return time.Parse(layout, s)
+}
+
+// formatTime formats t with layout, see parseTime.
+func formatTime(t time.Time, layout string) string {
+	switch strings.ToLower(layout) {
+	case "", "rfc3339":
+		return t.Format(time.RFC3339Nano)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixNano()/1e6, 10)
+	}
+	return t.Format(layout)
+}
+
+func (p *Parser) parseDuration(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+
+	if p.marshal {
+		p.marshalEnv(prefix+name, time.Duration(val.Int()).String())
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseDuration(envString)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.SetInt(int64(value))
+	return nil
+}
+
+func (p *Parser) parseTime(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+
+	if p.marshal {
+		p.marshalEnv(prefix+name, formatTime(val.Interface().(time.Time), opts["layout"]))
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseTime(envString, opts["layout"])
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.Set(reflect.ValueOf(value))
+	return nil
+}
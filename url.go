@@ -0,0 +1,174 @@
+package emp
+
+import (
+	"fmt"
+	"github.com/XMLHexagram/emp/empErr"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+var (
+	urlType       = reflect.TypeOf(url.URL{})
+	urlValuesType = reflect.TypeOf(url.Values{})
+)
+
+// URLParts is a URL decomposed into its components, for struct fields
+// tagged with "url":
+//
+//    type Model struct {
+//        DB_DSN emp.URLParts `emp:",url"`
+//    }
+//
+// Any struct with some of the fields of URLParts can be used instead, the
+// fields are parsed as usual, e.g. Port can be an int.
+type URLParts struct {
+	Scheme   string
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Path     string
+	Query    url.Values
+	Fragment string
+}
+
+// parseURL parses s and validates it against the "scheme" and
+// "requirehost" tag options.
+func parseURL(s string, opts tagOptions) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if schemes, ok := opts["scheme"]; ok {
+		found := false
+		for _, scheme := range strings.Split(schemes, "|") {
+			if strings.EqualFold(u.Scheme, scheme) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("scheme of %q is not one of %s", s, schemes)
+		}
+	}
+
+	if _, ok := opts["requirehost"]; ok && u.Host == "" {
+		return nil, fmt.Errorf("missing host in %q", s)
+	}
+
+	return u, nil
+}
+
+func (p *Parser) parseURL(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+
+	if p.marshal {
+		u := val.Interface().(url.URL)
+		p.marshalEnv(prefix+name, u.String())
+		return nil
+	}
+
+	key := prefix + name
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	value, err := parseURL(envString, opts)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	val.Set(reflect.ValueOf(*value))
+	return nil
+}
+
+// parseURLParts parses a URL from a single key into the fields of a struct
+// tagged with "url", see URLParts.
+func (p *Parser) parseURLParts(prefix string, name string, default_ string, directDefault bool, opts tagOptions, val reflect.Value) error {
+	val = reflect.Indirect(val)
+	key := prefix + name
+
+	if p.marshal {
+		parts := make(map[string]string)
+		for _, fieldName := range []string{"Scheme", "User", "Password", "Host", "Port", "Path", "Query", "Fragment"} {
+			field := val.FieldByName(fieldName)
+			if !field.IsValid() {
+				continue
+			}
+			if field.Type() == urlValuesType {
+				parts[fieldName] = field.Interface().(url.Values).Encode()
+				continue
+			}
+			v, err := p.formatValue(nil, field)
+			if err != nil {
+				return err
+			}
+			parts[fieldName] = v
+		}
+
+		u := url.URL{
+			Scheme:   parts["Scheme"],
+			Host:     parts["Host"],
+			Path:     parts["Path"],
+			RawQuery: parts["Query"],
+			Fragment: parts["Fragment"],
+		}
+		if port := parts["Port"]; port != "" && port != "0" {
+			u.Host = net.JoinHostPort(u.Host, port)
+		}
+		if parts["Password"] != "" {
+			u.User = url.UserPassword(parts["User"], parts["Password"])
+		} else if parts["User"] != "" {
+			u.User = url.User(parts["User"])
+		}
+
+		p.marshalEnv(key, u.String())
+		return nil
+	}
+
+	envString, err := p.getEnvString(key, default_, directDefault)
+	if err != nil {
+		return err
+	}
+
+	u, err := parseURL(envString, opts)
+	if err != nil {
+		return empErr.CannotParseEnvStringToTypeError.New().Wrap(err)
+	}
+
+	password, _ := u.User.Password()
+	parts := map[string]string{
+		"Scheme":   u.Scheme,
+		"User":     u.User.Username(),
+		"Password": password,
+		"Host":     u.Hostname(),
+		"Port":     u.Port(),
+		"Path":     u.Path,
+		"Query":    u.RawQuery,
+		"Fragment": u.Fragment,
+	}
+
+	for fieldName, part := range parts {
+		field := val.FieldByName(fieldName)
+		if !field.IsValid() || !field.CanSet() {
+			continue
+		}
+		if field.Type() == urlValuesType {
+			field.Set(reflect.ValueOf(u.Query()))
+			continue
+		}
+		if part == "" {
+			continue
+		}
+		err := p.parse("", "", part, true, nil, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,14 +3,52 @@ package emp
 import (
 	"fmt"
 	"github.com/XMLHexagram/emp/empErr"
-	"os"
 	"reflect"
+	"sort"
 	"strings"
 )
 
-func parseTagString(tagString string) (prefix string, name string, default_ string, isIgnore bool) {
+// tagOptions holds the options of a field tag that change the way the
+// field is parsed, e.g. "map:inline".
+type tagOptions map[string]string
+
+// tagOptionNames are the names of the options that parseTagString accepts.
+var tagOptionNames = map[string]bool{
+	"map":         true,
+	"layout":      true,
+	"parser":      true,
+	"hostport":    true,
+	"scheme":      true,
+	"requirehost": true,
+	"url":         true,
+	"bytesize":    true,
+	"percent":     true,
+	"flag":        true,
+	"json":        true,
+	"type":        true,
+	"oneof":       true,
+}
+
+// tagFlagNames are the names of the options that parseTagString also
+// accepts without a value, e.g. "hostport". They are options only after the
+// first part of the tag, which is always the key name, so that existing
+// keys with the same names keep working.
+var tagFlagNames = map[string]bool{
+	"hostport":    true,
+	"requirehost": true,
+	"url":         true,
+	"bytesize":    true,
+	"percent":     true,
+	"flag":        true,
+	"json":        true,
+	"ignorecase":  true,
+	"secret":      true,
+}
+
+func parseTagString(tagString string) (prefix string, name string, default_ string, isIgnore bool, opts tagOptions) {
+	opts = tagOptions{}
 	tagParts := strings.Split(tagString, ",")
-	for _, tagPart := range tagParts {
+	for i, tagPart := range tagParts {
 		if tagPart == "-" {
 			isIgnore = true
 			continue
@@ -23,10 +61,16 @@ func parseTagString(tagString string) (prefix string, name string, default_ stri
 		} else if strings.HasPrefix(tagPart, "default:") {
 			default_ = strings.TrimPrefix(tagPart, "default:")
 			continue
+		} else if j := strings.Index(tagPart, ":"); j > 0 && tagOptionNames[tagPart[:j]] {
+			opts[tagPart[:j]] = tagPart[j+1:]
+			continue
+		} else if i > 0 && tagFlagNames[tagPart] {
+			opts[tagPart] = ""
+			continue
 		}
 		name = tagPart
 	}
-	return prefix, name, default_, isIgnore
+	return prefix, name, default_, isIgnore, opts
 }
 
 func getKind(val reflect.Value) reflect.Kind {
@@ -35,12 +79,71 @@ func getKind(val reflect.Value) reflect.Kind {
 	return kind
 }
 
-func formatSliceAndArrayReflectValue(value reflect.Value) string {
-	res := make([]string, value.Len())
-	for i := 0; i < value.Len(); i++ {
-		res[i] = fmt.Sprintf("%v", value.Index(i).Interface())
+// isNestedType reports whether values of valType are made of several keys
+// under a prefix, rather than a single key.
+func (p *Parser) isNestedType(valType reflect.Type) bool {
+	for valType.Kind() == reflect.Ptr {
+		if p.isHookType(valType) {
+			return false
+		}
+		valType = valType.Elem()
+	}
+	return valType.Kind() == reflect.Struct && !builtinTypes[valType] && !isUnmarshalerType(valType) && !p.isHookType(valType) && !isOptionalType(valType)
+}
+
+// isNestedField is like isNestedType, but also takes the tag options of
+// a field into account, which may parse it from a single key.
+func (p *Parser) isNestedField(valType reflect.Type, opts tagOptions) bool {
+	if _, ok := opts["url"]; ok {
+		return false
+	}
+	if _, ok := opts["parser"]; ok {
+		return false
+	}
+	if _, ok := opts["json"]; ok {
+		return false
 	}
-	return strings.Join(res, ",")
+	return p.isNestedType(valType)
+}
+
+// isSingleKey reports whether a field of type valType tagged with opts is
+// read from a single key, rather than from several keys under a prefix.
+func (p *Parser) isSingleKey(valType reflect.Type, opts tagOptions) bool {
+	if _, ok := opts["json"]; ok {
+		return true
+	}
+	for valType.Kind() == reflect.Ptr {
+		valType = valType.Elem()
+	}
+
+	switch valType.Kind() {
+	case reflect.Map:
+		return opts["map"] == "inline"
+	case reflect.Slice, reflect.Array:
+		return !p.isNestedType(valType.Elem())
+	case reflect.Interface:
+		return len(p.types[valType]) == 0
+	case reflect.Struct:
+		return !p.isNestedField(valType, opts) && !isOptionalType(valType)
+	}
+	return true
+}
+
+// builtinTypes are the struct types that emp parses from a single key by
+// itself.
+var builtinTypes = map[reflect.Type]bool{
+	timeType:  true,
+	ipNetType: true,
+	urlType:   true,
+}
+
+// mapEntryPrefix returns the prefix of the keys of the entries of a map
+// stored under key.
+func mapEntryPrefix(key string) string {
+	if key == "" || strings.HasSuffix(key, "_") {
+		return key
+	}
+	return key + "_"
 }
 
 // ParseStringToArrayAndSlice is the default parser for string to slice
@@ -51,17 +154,85 @@ func ParseStringToArrayAndSlice(s string) []string {
 	return strings.Split(s, ",")
 }
 
-func getEnvString(key string, default_ string, directDefault bool, allowEmpty bool) (envString string, err error) {
-	if directDefault {
-		envString = default_
-	} else {
-		envString = os.Getenv(key)
-		if envString == "" {
-			envString = default_
+// ParseStringToMap is the default parser for string to map, it splits
+// comma separated key:value pairs, e.g. "X-Env:prod,X-Team:core".
+func ParseStringToMap(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	if s == "" {
+		return res, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.Index(pair, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("missing ':' in pair %q", pair)
+		}
+		res[pair[:i]] = pair[i+1:]
+	}
+	return res, nil
+}
+
+// FormatMapToString is the default formatter for map to string, the
+// counterpart of ParseStringToMap. Pairs are sorted by key. It fails for
+// keys that contain ',' or ':' and values that contain ',', which
+// ParseStringToMap could not read back.
+func FormatMapToString(m map[string]string) (string, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if strings.ContainsAny(k, ",:") {
+			return "", fmt.Errorf("map key %q contains ',' or ':'", k)
 		}
-		if envString == "" && !allowEmpty {
-			return "", empErr.NotAllowEmptyEnvError.New().Wrap("miss environment key: " + key)
+		if strings.Contains(m[k], ",") {
+			return "", fmt.Errorf("map value %q of key %q contains ','", m[k], k)
 		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]string, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, k+":"+m[k])
+	}
+	return strings.Join(res, ","), nil
+}
+
+// lookup is like Source.Lookup, but reports a key set to an empty value as
+// unset under EmptyUsesDefault.
+func (p *Parser) lookup(key string) (string, bool) {
+	envString, ok := p.source.Lookup(key)
+	if ok && envString == "" && p.config.EmptyPolicy == EmptyUsesDefault {
+		return "", false
+	}
+	return envString, ok
+}
+
+// keepValue reports whether val, whose key is unset, is kept as is
+// because of Config.KeepValues.
+func (p *Parser) keepValue(val reflect.Value) bool {
+	return p.config.KeepValues && !val.IsZero()
+}
+
+// getEnvString returns the value of key, or default_ if key is unset. A key
+// set to an empty value is handled according to Config.EmptyPolicy.
+func (p *Parser) getEnvString(key string, default_ string, directDefault bool) (envString string, err error) {
+	if directDefault {
+		return default_, nil
+	}
+
+	envString, ok := p.source.Lookup(key)
+	if ok && envString == "" {
+		switch p.config.EmptyPolicy {
+		case EmptyIsSet:
+			return "", nil
+		case EmptyIsError:
+			return "", empErr.NotAllowEmptyEnvError.New().Wrap("empty environment key: " + key)
+		}
+	}
+
+	if envString == "" {
+		envString = default_
+	}
+	if envString == "" && !p.config.AllowEmpty {
+		return "", empErr.NotAllowEmptyEnvError.New().Wrap("miss environment key: " + key)
 	}
 	return envString, nil
 }